@@ -3,6 +3,11 @@ module github.com/gorel/advent-2015
 go 1.20
 
 require (
-	github.com/golang-collections/collections v0.0.0-20130729185459-604e922904d3 // indirect
-	golang.org/x/exp v0.0.0-20231226003508-02704c960a9b // indirect
+	github.com/golang-collections/collections v0.0.0-20130729185459-604e922904d3
+	github.com/pelletier/go-toml/v2 v2.2.2
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/exp v0.0.0-20231226003508-02704c960a9b
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
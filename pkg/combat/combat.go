@@ -0,0 +1,256 @@
+// Package combat is the RPG fight model shared by days 21 and 22.
+//
+// A fight happens in an Arena between a Player and a Boss. Entities have
+// base stats, can be equipped with Items, and can be affected by timed
+// Effects that Spells put into play. Fight drives the turn loop: a variant
+// only has to describe what happens in each phase of a round.
+package combat
+
+import "fmt"
+
+// Entity is anything that can take part in a fight.
+type Entity struct {
+	Name   string
+	HP     int
+	Mana   int
+	Damage int
+	Armor  int
+
+	// BonusArmor comes from active effects and is recomputed every time
+	// effects tick, so it never stacks with itself.
+	BonusArmor int
+}
+
+func (e Entity) Dead() bool {
+	return e.HP <= 0
+}
+
+// TotalArmor is the armor an attack against this entity has to get through.
+func (e Entity) TotalArmor() int {
+	return e.Armor + e.BonusArmor
+}
+
+// Item is a piece of equipment bought in a shop.
+type Item struct {
+	Name   string
+	Cost   int
+	Damage int
+	Armor  int
+}
+
+// Equip returns a copy of e wearing the given items.
+func (e Entity) Equip(items ...Item) Entity {
+	for _, item := range items {
+		e.Damage += item.Damage
+		e.Armor += item.Armor
+	}
+	return e
+}
+
+// Cost is the total price of a set of items.
+func Cost(items ...Item) int {
+	total := 0
+	for _, item := range items {
+		total += item.Cost
+	}
+	return total
+}
+
+// Hit is how much damage an attack does against the given armor. Attacks
+// always do at least 1 damage.
+func Hit(damage, armor int) int {
+	if damage-armor < 1 {
+		return 1
+	}
+	return damage - armor
+}
+
+// Attack has e hit target once and returns the damage done.
+func (e Entity) Attack(target *Entity) int {
+	dmg := Hit(e.Damage, target.TotalArmor())
+	target.HP -= dmg
+	return dmg
+}
+
+// Effect is a timed effect put into play by a Spell. Every tick it gives
+// the player armor and mana and damages the boss.
+type Effect struct {
+	Name         string
+	Armor        int
+	Damage       int
+	ManaRecharge int
+	Turns        int
+}
+
+// Spell is cast by the player, either hitting immediately or starting an
+// Effect.
+type Spell struct {
+	Name    string
+	Mana    int
+	Damage  int
+	Healing int
+	Effect  *Effect
+}
+
+// Arena holds both sides of a fight and the effects currently active.
+type Arena struct {
+	Player  Entity
+	Boss    Entity
+	Effects map[string]Effect
+}
+
+func NewArena(player, boss Entity) Arena {
+	return Arena{
+		Player:  player,
+		Boss:    boss,
+		Effects: make(map[string]Effect),
+	}
+}
+
+// Clone returns a copy of the arena that can be changed independently.
+func (a Arena) Clone() Arena {
+	effects := make(map[string]Effect, len(a.Effects))
+	for key, e := range a.Effects {
+		effects[key] = e
+	}
+	a.Effects = effects
+	return a
+}
+
+// Over reports whether either side is dead.
+func (a Arena) Over() bool {
+	return a.Player.Dead() || a.Boss.Dead()
+}
+
+// TickEffects applies every active effect once and drops the ones that
+// run out. It returns the effects that ticked, with their remaining turns.
+func (a *Arena) TickEffects() []Effect {
+	var ticked []Effect
+	a.Player.BonusArmor = 0
+	for name, e := range a.Effects {
+		if e.Armor > a.Player.BonusArmor {
+			a.Player.BonusArmor = e.Armor
+		}
+		a.Boss.HP -= e.Damage
+		a.Player.Mana += e.ManaRecharge
+		e.Turns -= 1
+		if e.Turns > 0 {
+			a.Effects[name] = e
+		} else {
+			delete(a.Effects, name)
+		}
+		ticked = append(ticked, e)
+	}
+	return ticked
+}
+
+// CanCast returns why the player can't cast the spell right now, if anything.
+func (a Arena) CanCast(s Spell) error {
+	if a.Player.Mana < s.Mana {
+		return fmt.Errorf("not enough mana to cast %s (have %d, need %d)", s.Name, a.Player.Mana, s.Mana)
+	}
+	if s.Effect != nil {
+		if _, ok := a.Effects[s.Effect.Name]; ok {
+			return fmt.Errorf("%s is already active", s.Effect.Name)
+		}
+	}
+	return nil
+}
+
+// Cast has the player cast a spell. It doesn't check CanCast.
+func (a *Arena) Cast(s Spell) {
+	a.Player.Mana -= s.Mana
+	a.Boss.HP -= s.Damage
+	a.Player.HP += s.Healing
+	if s.Effect != nil {
+		a.Effects[s.Effect.Name] = *s.Effect
+	}
+}
+
+// Phase is one step of a round. Phases can change the arena however they
+// like; Fight checks whether the fight is over after each one.
+type Phase func(a *Arena)
+
+// PlayerAttacks is the phase where the player hits the boss with their weapon.
+func PlayerAttacks(a *Arena) {
+	a.Player.Attack(&a.Boss)
+}
+
+// BossAttacks is the phase where the boss hits the player.
+func BossAttacks(a *Arena) {
+	a.Boss.Attack(&a.Player)
+}
+
+// TickEffects is the phase where active effects apply.
+func TickEffects(a *Arena) {
+	a.TickEffects()
+}
+
+// Fight runs rounds made of the given phases until one side is dead, and
+// returns the final arena and how many rounds were started. Every phase has
+// to bring the fight closer to an end or Fight will never return.
+func Fight(a Arena, phases ...Phase) (Arena, int) {
+	a = a.Clone()
+	rounds := 0
+	for {
+		rounds++
+		for _, phase := range phases {
+			phase(&a)
+			if a.Over() {
+				return a, rounds
+			}
+		}
+	}
+}
+
+// HitsToKill is how many attacks it takes attacker to bring defender down,
+// worked out without simulating the fight.
+func HitsToKill(attacker Entity, defender Entity) int {
+	if defender.HP <= 0 {
+		return 0
+	}
+	dmg := Hit(attacker.Damage, defender.TotalArmor())
+	return (defender.HP + dmg - 1) / dmg
+}
+
+// DuelResult is how a melee fight with no effects or spells ends.
+type DuelResult struct {
+	PlayerWins bool
+	// Rounds is how many times the winner attacked
+	Rounds       int
+	PlayerHPLeft int
+	BossHPLeft   int
+}
+
+// Duel works out a fight where the player and boss take turns hitting each
+// other, player first, in closed form. It gives the same answer as
+// Fight(NewArena(player, boss), PlayerAttacks, BossAttacks).
+func Duel(player Entity, boss Entity) DuelResult {
+	playerHits := HitsToKill(player, boss)
+	bossHits := HitsToKill(boss, player)
+	playerDmg := Hit(player.Damage, boss.TotalArmor())
+	bossDmg := Hit(boss.Damage, player.TotalArmor())
+
+	// The player strikes first, so they win ties
+	if playerHits <= bossHits {
+		return DuelResult{
+			PlayerWins:   true,
+			Rounds:       playerHits,
+			PlayerHPLeft: player.HP - max(0, playerHits-1)*bossDmg,
+			BossHPLeft:   boss.HP - playerHits*playerDmg,
+		}
+	}
+	return DuelResult{
+		PlayerWins:   false,
+		Rounds:       bossHits,
+		PlayerHPLeft: player.HP - bossHits*bossDmg,
+		BossHPLeft:   boss.HP - bossHits*playerDmg,
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
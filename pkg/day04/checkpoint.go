@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Checkpoint is a search saved to disk. Every nonce from the start of the
+// search up to Next has been checked without a match, unless Found is set.
+type Checkpoint struct {
+	Key       string `json:"key"`
+	Hash      string `json:"hash"`
+	Predicate string `json:"predicate"`
+	Next      int64  `json:"next"`
+	// End is where the search stops, 0 for never
+	End   int64  `json:"end,omitempty"`
+	Found *int64 `json:"found,omitempty"`
+}
+
+// Save writes the checkpoint to a temporary file first so a crash
+// mid-write can't lose the previous one.
+func (c Checkpoint) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCheckpoint reads a checkpoint. A missing file isn't an error, it
+// just means starting from scratch, and ok is false.
+func LoadCheckpoint(path string) (c Checkpoint, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Checkpoint{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, true, nil
+}
+
+// Matches reports whether c was saved by the same search as other, so it's
+// safe to resume from.
+func (c Checkpoint) Matches(other Checkpoint) error {
+	if c.Key != other.Key || c.Hash != other.Hash || c.Predicate != other.Predicate || c.End != other.End {
+		return fmt.Errorf("checkpoint is for key %q, %s, %s, end %d, not key %q, %s, %s, end %d",
+			c.Key, c.Hash, c.Predicate, c.End, other.Key, other.Hash, other.Predicate, other.End)
+	}
+	return nil
+}
@@ -2,41 +2,105 @@ package main
 
 import (
 	"bufio"
-	"crypto/md5"
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"runtime"
+	"time"
 )
 
-func valid(key string, i int, leading int) bool {
-	s := key + strconv.Itoa(i)
-	md5 := fmt.Sprintf("%x", md5.Sum([]byte(s)))
-	return md5[0:leading] == strings.Repeat("0", leading)
-}
+var (
+	workers    = flag.Int("workers", runtime.NumCPU(), "number of goroutines hashing nonces")
+	hashName   = flag.String("hash", "md5", "hash to mine with: "+hashNames())
+	target     = flag.String("target", "", "only find the lowest nonce whose digest matches, like zeros:5, bits:20, prefix:abc or below:0fff")
+	from       = flag.Int64("from", 0, "first nonce to try with -target")
+	to         = flag.Int64("to", 0, "stop before this nonce with -target (0 for no end)")
+	checkpoint = flag.String("checkpoint", "", "save progress on -target searches to this file, and resume from it if it exists")
+	every      = flag.Duration("every", 10*time.Second, "how often to save the checkpoint")
+)
 
 func main() {
+	flag.Parse()
 	scanner := bufio.NewScanner(os.Stdin)
 	var key string
 	for scanner.Scan() {
 		key = scanner.Text()
 	}
 
-	i := 0
-	part1 := -1
-	part2 := -1
-	for {
-		if valid(key, i, 5) {
-			if part1 == -1 {
-				part1 = i
+	newHash, ok := hashes[*hashName]
+	if !ok {
+		log.Fatalf("unknown hash %q, want one of %s", *hashName, hashNames())
+	}
+	opts := []minerOption{withWorkers(*workers), withHash(*hashName, newHash)}
+
+	if *target != "" {
+		mineTarget(key, opts)
+		return
+	}
+
+	m := NewMiner(key, opts...)
+	ctx := context.Background()
+	part1, err := m.Mine(ctx, 0, 0, leadingZeroNibbles(5))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Six zeros means five zeros too, so part 2 can't come before part 1
+	part2, err := m.Mine(ctx, part1.Nonce, 0, leadingZeroNibbles(6))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Part 1: %d\n", part1.Nonce)
+	fmt.Printf("Part 2: %d\n", part2.Nonce)
+}
+
+// mineTarget runs a single search for -target. With -checkpoint, stopping
+// it with ^C saves where it got to, and running it again carries on.
+func mineTarget(key string, opts []minerOption) {
+	p, err := parsePredicate(*target)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	state := Checkpoint{Key: key, Hash: *hashName, Predicate: p.Name, Next: *from, End: *to}
+	if *checkpoint != "" {
+		saved, ok, err := LoadCheckpoint(*checkpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ok {
+			if err := saved.Matches(state); err != nil {
+				log.Fatal(err)
 			}
-			if valid(key, i, 6) {
-				part2 = i
-				break
+			if saved.Found != nil {
+				fmt.Printf("%s: %d (from checkpoint)\n", p.Name, *saved.Found)
+				return
 			}
+			log.Printf("resuming from nonce %d", saved.Next)
+			state = saved
 		}
-		i += 1
+		opts = append(opts, withCheckpoints(*every, func(next int64) {
+			cp := state
+			cp.Next = next
+			if err := cp.Save(*checkpoint); err != nil {
+				log.Print(err)
+			}
+		}))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	res, err := NewMiner(key, opts...).Mine(ctx, state.Next, state.End, p)
+	if res.Found && *checkpoint != "" {
+		state.Next, state.Found = res.Next, &res.Nonce
+		if err := state.Save(*checkpoint); err != nil {
+			log.Print(err)
+		}
+	}
+	if err != nil {
+		log.Fatalf("%v, resume from nonce %d", err, res.Next)
 	}
-	fmt.Printf("Part 1: %d\n", part1)
-	fmt.Printf("Part 2: %d\n", part2)
+	fmt.Printf("%s: %d\n", p.Name, res.Nonce)
 }
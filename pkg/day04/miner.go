@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNotFound = errors.New("no nonce in range")
+
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+func hashNames() string {
+	var names []string
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Miner looks for nonces that make hash(key + nonce) satisfy a predicate.
+type Miner struct {
+	key      string
+	hashName string
+	newHash  func() hash.Hash
+	workers  int
+	// batch is how many nonces a worker claims at a time
+	batch int64
+	// prefix is the hash state after writing the key, so workers only hash
+	// the nonce each time. It's nil for hashes that can't save their state.
+	prefix []byte
+
+	checkpointEvery time.Duration
+	checkpoint      func(next int64)
+}
+
+type minerOption func(*Miner)
+
+func withWorkers(n int) minerOption {
+	return func(m *Miner) {
+		if n > 0 {
+			m.workers = n
+		}
+	}
+}
+
+// withHash mines with any hash. name identifies it in checkpoints.
+func withHash(name string, newHash func() hash.Hash) minerOption {
+	return func(m *Miner) {
+		m.hashName = name
+		m.newHash = newHash
+	}
+}
+
+// withCheckpoints calls f every so often with a nonce that everything
+// before has been checked, so a search can pick up from there later.
+func withCheckpoints(every time.Duration, f func(next int64)) minerOption {
+	return func(m *Miner) {
+		m.checkpointEvery = every
+		m.checkpoint = f
+	}
+}
+
+func NewMiner(key string, opts ...minerOption) *Miner {
+	m := &Miner{
+		key:      key,
+		hashName: "md5",
+		newHash:  md5.New,
+		workers:  1,
+		batch:    1 << 12,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	h := m.newHash()
+	h.Write([]byte(key))
+	if saver, ok := h.(encoding.BinaryMarshaler); ok {
+		if _, ok := h.(encoding.BinaryUnmarshaler); ok {
+			m.prefix, _ = saver.MarshalBinary()
+		}
+	}
+	return m
+}
+
+// worker hashes nonces for one goroutine.
+type worker struct {
+	m   *Miner
+	h   hash.Hash
+	buf []byte
+	sum []byte
+}
+
+func (m *Miner) newWorker() *worker {
+	h := m.newHash()
+	return &worker{
+		m:   m,
+		h:   h,
+		buf: make([]byte, 0, 20),
+		sum: make([]byte, 0, h.Size()),
+	}
+}
+
+func (w *worker) digest(nonce int64) []byte {
+	if w.m.prefix != nil {
+		w.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(w.m.prefix)
+	} else {
+		w.h.Reset()
+		w.h.Write([]byte(w.m.key))
+	}
+	w.buf = strconv.AppendInt(w.buf[:0], nonce, 10)
+	w.h.Write(w.buf)
+	w.sum = w.h.Sum(w.sum[:0])
+	return w.sum
+}
+
+// frontier tracks which batches are finished, so there's always a nonce
+// that everything below has been checked.
+type frontier struct {
+	mu    sync.Mutex
+	next  int64
+	batch int64
+	done  map[int64]bool
+}
+
+func (f *frontier) finish(start int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done[start] = true
+	for f.done[f.next] {
+		delete(f.done, f.next)
+		f.next += f.batch
+	}
+}
+
+func (f *frontier) get() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.next
+}
+
+// Result is where a search got to. Next is a nonce that every nonce below
+// it, from the start of the search, has been checked, and is where to
+// resume if the search was cut short.
+type Result struct {
+	Nonce int64
+	Found bool
+	Next  int64
+}
+
+// Mine finds the lowest nonce in [from, to) whose digest satisfies p. A to
+// of 0 means there's no end. Workers claim batches of nonces in order and
+// stop once every batch below the best nonce found so far is done, so the
+// answer is the same however many workers run. If ctx is done first the
+// result says where to carry on from.
+func (m *Miner) Mine(ctx context.Context, from, to int64, p Predicate) (Result, error) {
+	if size := m.newHash().Size(); p.Need > size {
+		return Result{Next: from}, fmt.Errorf("%s looks at %d bytes but %s digests only have %d", p.Name, p.Need, m.hashName, size)
+	}
+	if to <= 0 {
+		to = math.MaxInt64
+	}
+
+	var next atomic.Int64
+	next.Store(from)
+	var best atomic.Int64
+	best.Store(math.MaxInt64)
+	fr := &frontier{next: from, batch: m.batch, done: make(map[int64]bool)}
+	// The frontier can pass a match while the batches below it finish, and
+	// resuming from there would skip it, so checkpoints stop at the best
+	// match instead
+	resumeAt := func(next int64) int64 {
+		if b := best.Load(); b < next {
+			return b
+		}
+		return next
+	}
+
+	stop := make(chan struct{})
+	if m.checkpoint != nil && m.checkpointEvery > 0 {
+		ticker := time.NewTicker(m.checkpointEvery)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					m.checkpoint(resumeAt(fr.get()))
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := m.newWorker()
+			for ctx.Err() == nil {
+				start := next.Add(m.batch) - m.batch
+				if start >= best.Load() || start >= to {
+					return
+				}
+				end := start + m.batch
+				if end > to {
+					end = to
+				}
+				for nonce := start; nonce < end; nonce++ {
+					if !p.Match(w.digest(nonce)) {
+						continue
+					}
+					for {
+						cur := best.Load()
+						if nonce >= cur || best.CompareAndSwap(cur, nonce) {
+							break
+						}
+					}
+					break
+				}
+				fr.finish(start)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+
+	res := Result{Nonce: best.Load(), Next: fr.get()}
+	if res.Next > to {
+		res.Next = to
+	}
+	res.Found = res.Nonce < res.Next
+	if m.checkpoint != nil {
+		m.checkpoint(resumeAt(res.Next))
+	}
+	switch {
+	case res.Found:
+		return res, nil
+	case ctx.Err() != nil:
+		return res, ctx.Err()
+	default:
+		return res, fmt.Errorf("%w [%d, %d)", ErrNotFound, from, to)
+	}
+}
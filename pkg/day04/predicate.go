@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Predicate decides whether a digest is good enough. Need is how many bytes
+// of the digest it looks at, so it can't be used with shorter hashes.
+type Predicate struct {
+	Name  string
+	Need  int
+	Match func(sum []byte) bool
+}
+
+// leadingZeros reports whether the hex form of sum starts with n zeros,
+// without formatting it.
+func leadingZeros(sum []byte, n int) bool {
+	for i := 0; i < n/2; i++ {
+		if sum[i] != 0 {
+			return false
+		}
+	}
+	return n%2 == 0 || sum[n/2]>>4 == 0
+}
+
+// leadingZeroNibbles is the puzzle's rule: n leading zeros in hex.
+func leadingZeroNibbles(n int) Predicate {
+	return Predicate{
+		Name: fmt.Sprintf("zeros:%d", n),
+		Need: (n + 1) / 2,
+		Match: func(sum []byte) bool {
+			return leadingZeros(sum, n)
+		},
+	}
+}
+
+func leadingZeroBits(n int) Predicate {
+	return Predicate{
+		Name: fmt.Sprintf("bits:%d", n),
+		Need: (n + 7) / 8,
+		Match: func(sum []byte) bool {
+			for i := 0; i < n/8; i++ {
+				if sum[i] != 0 {
+					return false
+				}
+			}
+			return n%8 == 0 || sum[n/8]>>(8-n%8) == 0
+		},
+	}
+}
+
+// hexPrefix matches digests whose hex form starts with prefix.
+func hexPrefix(prefix string) (Predicate, error) {
+	prefix = strings.ToLower(prefix)
+	nibbles := make([]byte, len(prefix))
+	for i, c := range prefix {
+		n, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			return Predicate{}, fmt.Errorf("prefix %q isn't hex", prefix)
+		}
+		nibbles[i] = byte(n)
+	}
+	return Predicate{
+		Name: "prefix:" + prefix,
+		Need: (len(nibbles) + 1) / 2,
+		Match: func(sum []byte) bool {
+			for i, n := range nibbles {
+				b := sum[i/2]
+				if i%2 == 0 {
+					b >>= 4
+				}
+				if b&0xf != n {
+					return false
+				}
+			}
+			return true
+		},
+	}, nil
+}
+
+// belowTarget matches digests that are less than target, both read as big
+// endian numbers. A target shorter than the digest is padded with zeros on
+// the right, so below:0001 needs a digest under 0001000...
+func belowTarget(target string) (Predicate, error) {
+	target = strings.ToLower(target)
+	padded := target
+	if len(padded)%2 == 1 {
+		padded += "0"
+	}
+	t, err := hex.DecodeString(padded)
+	if err != nil || len(t) == 0 {
+		return Predicate{}, fmt.Errorf("target %q isn't hex", target)
+	}
+	return Predicate{
+		Name: "below:" + target,
+		Need: len(t),
+		Match: func(sum []byte) bool {
+			for i, b := range t {
+				if sum[i] != b {
+					return sum[i] < b
+				}
+			}
+			return false
+		},
+	}, nil
+}
+
+// parsePredicate reads the kind:value form predicates use for their names,
+// like zeros:5, bits:20, prefix:00c0ffee or below:0000ffff.
+func parsePredicate(spec string) (Predicate, error) {
+	kind, value, ok := strings.Cut(spec, ":")
+	if !ok {
+		return Predicate{}, fmt.Errorf("predicate %q should look like zeros:5, bits:20, prefix:abc or below:0fff", spec)
+	}
+	switch kind {
+	case "zeros", "bits":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return Predicate{}, fmt.Errorf("predicate %q needs a count", spec)
+		}
+		if kind == "zeros" {
+			return leadingZeroNibbles(n), nil
+		}
+		return leadingZeroBits(n), nil
+	case "prefix":
+		return hexPrefix(value)
+	case "below":
+		return belowTarget(value)
+	}
+	return Predicate{}, fmt.Errorf("unknown predicate %q", kind)
+}
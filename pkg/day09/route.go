@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrNoRoute = errors.New("no route visits every location")
+
+// noRoad marks locations with no road between them.
+const noRoad = -1
+
+// Graph is the locations and the roads between them.
+type Graph struct {
+	names []string
+	index map[string]int
+	dist  [][]int32
+}
+
+func NewGraph() *Graph {
+	return &Graph{index: make(map[string]int)}
+}
+
+func (g *Graph) location(name string) int {
+	if i, ok := g.index[name]; ok {
+		return i
+	}
+	i := len(g.names)
+	g.index[name] = i
+	g.names = append(g.names, name)
+	for j := range g.dist {
+		g.dist[j] = append(g.dist[j], noRoad)
+	}
+	g.dist = append(g.dist, make([]int32, i+1))
+	for j := range g.dist[i] {
+		g.dist[i][j] = noRoad
+	}
+	g.dist[i][i] = 0
+	return i
+}
+
+func (g *Graph) AddRoad(from, to string, dist int) error {
+	if dist < 0 || dist > math.MaxInt32 {
+		return fmt.Errorf("road from %s to %s is %d long", from, to, dist)
+	}
+	a, b := g.location(from), g.location(to)
+	g.dist[a][b], g.dist[b][a] = int32(dist), int32(dist)
+	return nil
+}
+
+// Route is an order to visit every location in, and how far that is.
+type Route struct {
+	Locations []string
+	Distance  int
+}
+
+func (g *Graph) ShortestRoute() (Route, error) {
+	return g.bestRoute(1)
+}
+
+// LongestRoute is the shortest route with every road counted as negative.
+func (g *Graph) LongestRoute() (Route, error) {
+	return g.bestRoute(-1)
+}
+
+// maxLocations keeps the table in bestRoute to a few GB: it needs 2^n·n·4
+// bytes, 3.4GB for 25 locations.
+const maxLocations = 25
+
+// unvisited marks sets of locations there's no route through in the table.
+const unvisited = math.MaxInt32
+
+// bestRoute finds the shortest route with every road's length multiplied by
+// sign, using Held-Karp: the shortest way to visit each set of locations
+// ending at each one of them only depends on the shortest ways to visit
+// that set without it. That's O(2^n·n²) time and 2^n·n distances of memory,
+// so it manages a couple of dozen locations.
+func (g *Graph) bestRoute(sign int32) (Route, error) {
+	n := len(g.names)
+	if n == 0 {
+		return Route{}, ErrNoRoute
+	}
+	if n > maxLocations {
+		return Route{}, fmt.Errorf("%d locations is more than %d: finding a route would need %.3g GB of memory", n, maxLocations, math.Ldexp(float64(n)*4, n)/1e9)
+	}
+	if err := g.checkOverflow(); err != nil {
+		return Route{}, err
+	}
+	// roads[last] lists the roads into last with their signed lengths
+	type road struct {
+		from int
+		dist int32
+	}
+	roads := make([][]road, n)
+	for a, row := range g.dist {
+		for b, d := range row {
+			if a != b && d != noRoad {
+				roads[b] = append(roads[b], road{a, sign * d})
+			}
+		}
+	}
+
+	// best[mask*n+last] is the shortest distance to visit the locations in
+	// mask ending at last
+	best := make([]int32, (1<<n)*n)
+	for i := range best {
+		best[i] = unvisited
+	}
+	for i := 0; i < n; i++ {
+		best[(1<<i)*n+i] = 0
+	}
+	// Each entry only looks at one row of the table, for the set without
+	// last, which keeps it in cache
+	for mask := 1; mask < 1<<n; mask++ {
+		for last := 0; last < n; last++ {
+			prev := mask &^ (1 << last)
+			if prev == mask || prev == 0 {
+				continue
+			}
+			row := best[prev*n : prev*n+n]
+			shortest := int32(unvisited)
+			for _, r := range roads[last] {
+				if d := row[r.from]; d != unvisited && d+r.dist < shortest {
+					shortest = d + r.dist
+				}
+			}
+			best[mask*n+last] = shortest
+		}
+	}
+
+	all := 1<<n - 1
+	end := 0
+	for last := 1; last < n; last++ {
+		if best[all*n+last] < best[all*n+end] {
+			end = last
+		}
+	}
+	if best[all*n+end] == unvisited {
+		return Route{}, ErrNoRoute
+	}
+
+	// Walk back through the table for a location that leads to the best
+	// distance at every step
+	route := Route{Distance: int(sign * best[all*n+end])}
+	for mask, last := all, end; ; {
+		route.Locations = append(route.Locations, g.names[last])
+		prev := mask &^ (1 << last)
+		if prev == 0 {
+			break
+		}
+		for p := 0; p < n; p++ {
+			d, road := best[prev*n+p], g.dist[p][last]
+			if prev&(1<<p) != 0 && d != unvisited && road != noRoad && d+sign*road == best[mask*n+last] {
+				mask, last = prev, p
+				break
+			}
+		}
+	}
+	for i, j := 0, len(route.Locations)-1; i < j; i, j = i+1, j-1 {
+		route.Locations[i], route.Locations[j] = route.Locations[j], route.Locations[i]
+	}
+	return route, nil
+}
+
+// checkOverflow makes sure no route can be too long for the table, or as
+// long as unvisited.
+func (g *Graph) checkOverflow() error {
+	total := int64(0)
+	for _, row := range g.dist {
+		longest := int32(0)
+		for _, d := range row {
+			if d > longest {
+				longest = d
+			}
+		}
+		total += int64(longest)
+	}
+	if total >= unvisited {
+		return fmt.Errorf("routes could be up to %d long, more than %d", total, math.MaxInt32)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// element is one of Conway's 92 common elements: a string that, once it
+// shows up in a look-and-say sequence, evolves independently of whatever is
+// next to it. decay is what it becomes after one step.
+type element struct {
+	name  string
+	seq   string
+	decay string
+}
+
+var elements = []element{
+	{"H", "22", "H"},
+	{"He", "13112221133211322112211213322112", "Hf Pa H Ca Li"},
+	{"Li", "312211322212221121123222112", "He"},
+	{"Be", "111312211312113221133211322112211213322112", "Ge Ca Li"},
+	{"B", "1321132122211322212221121123222112", "Be"},
+	{"C", "3113112211322112211213322112", "B"},
+	{"N", "111312212221121123222112", "C"},
+	{"O", "132112211213322112", "N"},
+	{"F", "31121123222112", "O"},
+	{"Ne", "111213322112", "F"},
+	{"Na", "123222112", "Ne"},
+	{"Mg", "3113322112", "Pm Na"},
+	{"Al", "1113222112", "Mg"},
+	{"Si", "1322112", "Al"},
+	{"P", "311311222112", "Ho Si"},
+	{"S", "1113122112", "P"},
+	{"Cl", "132112", "S"},
+	{"Ar", "3112", "Cl"},
+	{"K", "1112", "Ar"},
+	{"Ca", "12", "K"},
+	{"Sc", "3113112221133112", "Ho Pa H Ca Co"},
+	{"Ti", "11131221131112", "Sc"},
+	{"V", "13211312", "Ti"},
+	{"Cr", "31132", "V"},
+	{"Mn", "111311222112", "Cr Si"},
+	{"Fe", "13122112", "Mn"},
+	{"Co", "32112", "Fe"},
+	{"Ni", "11133112", "Zn Co"},
+	{"Cu", "131112", "Ni"},
+	{"Zn", "312", "Cu"},
+	{"Ga", "13221133122211332", "Eu Ca Ac H Ca Zn"},
+	{"Ge", "31131122211311122113222", "Ho Ga"},
+	{"As", "11131221131211322113322112", "Ge Na"},
+	{"Se", "13211321222113222112", "As"},
+	{"Br", "3113112211322112", "Se"},
+	{"Kr", "11131221222112", "Br"},
+	{"Rb", "1321122112", "Kr"},
+	{"Sr", "3112112", "Rb"},
+	{"Y", "1112133", "Sr U"},
+	{"Zr", "12322211331222113112211", "Y H Ca Tc"},
+	{"Nb", "1113122113322113111221131221", "Er Zr"},
+	{"Mo", "13211322211312113211", "Nb"},
+	{"Tc", "311322113212221", "Mo"},
+	{"Ru", "132211331222113112211", "Eu Ca Tc"},
+	{"Rh", "311311222113111221131221", "Ho Ru"},
+	{"Pd", "111312211312113211", "Rh"},
+	{"Ag", "132113212221", "Pd"},
+	{"Cd", "3113112211", "Ag"},
+	{"In", "11131221", "Cd"},
+	{"Sn", "13211", "In"},
+	{"Sb", "3112221", "Pm Sn"},
+	{"Te", "1322113312211", "Eu Ca Sb"},
+	{"I", "311311222113111221", "Ho Te"},
+	{"Xe", "11131221131211", "I"},
+	{"Cs", "13211321", "Xe"},
+	{"Ba", "311311", "Cs"},
+	{"La", "11131", "Ba"},
+	{"Ce", "1321133112", "La H Ca Co"},
+	{"Pr", "31131112", "Ce"},
+	{"Nd", "111312", "Pr"},
+	{"Pm", "132", "Nd"},
+	{"Sm", "311332", "Pm Ca Zn"},
+	{"Eu", "1113222", "Sm"},
+	{"Gd", "13221133112", "Eu Ca Co"},
+	{"Tb", "3113112221131112", "Ho Gd"},
+	{"Dy", "111312211312", "Tb"},
+	{"Ho", "1321132", "Dy"},
+	{"Er", "311311222", "Ho Pm"},
+	{"Tm", "11131221133112", "Er Ca Co"},
+	{"Yb", "1321131112", "Tm"},
+	{"Lu", "311312", "Yb"},
+	{"Hf", "11132", "Lu"},
+	{"Ta", "13112221133211322112211213322113", "Hf Pa H Ca W"},
+	{"W", "312211322212221121123222113", "Ta"},
+	{"Re", "111312211312113221133211322112211213322113", "Ge Ca W"},
+	{"Os", "1321132122211322212221121123222113", "Re"},
+	{"Ir", "3113112211322112211213322113", "Os"},
+	{"Pt", "111312212221121123222113", "Ir"},
+	{"Au", "132112211213322113", "Pt"},
+	{"Hg", "31121123222113", "Au"},
+	{"Tl", "111213322113", "Hg"},
+	{"Pb", "123222113", "Tl"},
+	{"Bi", "3113322113", "Pm Pb"},
+	{"Po", "1113222113", "Bi"},
+	{"At", "1322113", "Po"},
+	{"Rn", "311311222113", "Ho At"},
+	{"Fr", "1113122113", "Rn"},
+	{"Ra", "132113", "Fr"},
+	{"Ac", "3113", "Ra"},
+	{"Th", "1113", "Ac"},
+	{"Pa", "13", "Th"},
+	{"U", "3", "Pa"},
+}
+
+// periodicTable is the element data in the form the length calculation
+// wants.
+type periodicTable struct {
+	index map[string]int
+	// decays[e] lists the elements e turns into, in order
+	decays [][]int
+	// splits[a][b] is set when a followed by b never interact, now or in
+	// any later step
+	splits [][]bool
+	// bySeq finds elements by their digits
+	bySeq  map[string]int
+	maxLen int
+}
+
+var table = newPeriodicTable()
+
+func newPeriodicTable() *periodicTable {
+	t := &periodicTable{index: make(map[string]int), bySeq: make(map[string]int)}
+	for i, e := range elements {
+		t.index[e.name] = i
+		t.bySeq[e.seq] = i
+		if len(e.seq) > t.maxLen {
+			t.maxLen = len(e.seq)
+		}
+	}
+	for _, e := range elements {
+		var decay []int
+		var seq strings.Builder
+		for _, name := range strings.Fields(e.decay) {
+			decay = append(decay, t.index[name])
+			seq.WriteString(elements[t.index[name]].seq)
+		}
+		if next := lookAndSay(e.seq, 1); seq.String() != next {
+			panic(fmt.Sprintf("%s decays to %s, not %s", e.name, next, e.decay))
+		}
+		t.decays = append(t.decays, decay)
+	}
+
+	n := len(elements)
+	t.splits = make([][]bool, n)
+	for a := range t.splits {
+		t.splits[a] = make([]bool, n)
+		for b := range t.splits[a] {
+			t.splits[a][b] = t.alwaysSplits(a, b)
+		}
+	}
+	return t
+}
+
+// alwaysSplits follows the boundary between a and b forward. Runs can only
+// merge across it when the digits on either side match. The digit on the
+// left never changes, since look-and-say always ends with the last digit it
+// read, and the digit on the right becomes the length of b's first run. The
+// boundary then sits between the last element a decays to and the first
+// one b does, so there are only finitely many boundaries to check.
+func (t *periodicTable) alwaysSplits(a, b int) bool {
+	seen := make(map[[2]int]bool)
+	for !seen[[2]int{a, b}] {
+		seen[[2]int{a, b}] = true
+		left, right := elements[a].seq, elements[b].seq
+		if left[len(left)-1] == right[0] {
+			return false
+		}
+		da, db := t.decays[a], t.decays[b]
+		a, b = da[len(da)-1], db[0]
+	}
+	return true
+}
+
+// decompose splits s into elements with every boundary a permanent split,
+// if it can be.
+func (t *periodicTable) decompose(s string) ([]int, bool) {
+	// reach[i] lists the elements that can end a decomposition of s[:i]
+	reach := make([][]int, len(s)+1)
+	from := make([]map[int][2]int, len(s)+1)
+	for i := 1; i <= len(s); i++ {
+		from[i] = make(map[int][2]int)
+		for l := 1; l <= t.maxLen && l <= i; l++ {
+			e, ok := t.bySeq[s[i-l:i]]
+			if !ok {
+				continue
+			}
+			if i == l {
+				from[i][e] = [2]int{0, -1}
+				continue
+			}
+			for _, prev := range reach[i-l] {
+				if t.splits[prev][e] {
+					from[i][e] = [2]int{i - l, prev}
+					break
+				}
+			}
+		}
+		for e := range from[i] {
+			reach[i] = append(reach[i], e)
+		}
+	}
+	if len(reach[len(s)]) == 0 {
+		return nil, false
+	}
+
+	var parts []int
+	for i, e := len(s), reach[len(s)][0]; i > 0; {
+		parts = append(parts, e)
+		prev := from[i][e]
+		i, e = prev[0], prev[1]
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return parts, true
+}
+
+// LengthAfter is the length of the look-and-say sequence n steps on from
+// seed. Once the sequence is made of Conway's elements only how many of
+// each there are matters, so it tracks those counts instead of the string.
+// Seeds that aren't made of elements are simulated a step at a time until
+// they are, which for seeds without digits above 3 takes a few dozen steps
+// at most; anything else is simulated all the way.
+func LengthAfter(seed string, n int) *big.Int {
+	s := seed
+	for step := 0; step < n; step++ {
+		if parts, ok := table.decompose(s); ok {
+			return table.lengthAfter(parts, n-step)
+		}
+		s = lookAndSay(s, 1)
+	}
+	return big.NewInt(int64(len(s)))
+}
+
+func (t *periodicTable) lengthAfter(parts []int, n int) *big.Int {
+	counts := make([]*big.Int, len(elements))
+	for i := range counts {
+		counts[i] = new(big.Int)
+	}
+	for _, e := range parts {
+		counts[e].Add(counts[e], big.NewInt(1))
+	}
+	for step := 0; step < n; step++ {
+		next := make([]*big.Int, len(elements))
+		for i := range next {
+			next[i] = new(big.Int)
+		}
+		for e, count := range counts {
+			if count.Sign() == 0 {
+				continue
+			}
+			for _, d := range t.decays[e] {
+				next[d].Add(next[d], count)
+			}
+		}
+		counts = next
+	}
+
+	total := new(big.Int)
+	for e, count := range counts {
+		total.Add(total, new(big.Int).Mul(count, big.NewInt(int64(len(elements[e].seq)))))
+	}
+	return total
+}
@@ -2,43 +2,75 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"strconv"
 	"strings"
 )
 
+// step appends one look-and-say step of src to dst.
+func step(dst, src []byte) []byte {
+	for i := 0; i < len(src); {
+		j := i + 1
+		for j < len(src) && src[j] == src[i] {
+			j++
+		}
+		dst = strconv.AppendInt(dst, int64(j-i), 10)
+		dst = append(dst, src[i])
+		i = j
+	}
+	return dst
+}
+
 func lookAndSay(s string, n int) string {
-	res := s
+	cur := []byte(s)
+	var next []byte
 	for i := 0; i < n; i++ {
-		var cur strings.Builder
-		curChar := res[0]
-		curCount := 1
-		for j := 1; j < len(res); j++ {
-			if res[j] == curChar {
-				curCount++
-			} else {
-				cur.WriteString(fmt.Sprintf("%d%c", curCount, curChar))
-				curChar = res[j]
-				curCount = 1
-			}
-		}
-		cur.WriteString(fmt.Sprintf("%d%c", curCount, curChar))
-		res = cur.String()
+		next = step(next[:0], cur)
+		cur, next = next, cur
 	}
-	return res
+	return string(cur)
 }
 
+var (
+	steps     = flag.Int("n", 0, "print the length after this many steps instead of the puzzle answers")
+	printStep = flag.Int("print", -1, "stream the sequence after this many steps to stdout")
+	statsStep = flag.Int("stats", -1, "print digit and run statistics for every step up to this one")
+)
+
 func main() {
+	flag.Parse()
 	scanner := bufio.NewScanner(os.Stdin)
 
-	res := ""
-	res2 := ""
+	var seed string
 	for scanner.Scan() {
-		line := scanner.Text()
-		res = lookAndSay(line, 40)
-		res2 = lookAndSay(line, 50)
+		seed = scanner.Text()
 	}
 
-	fmt.Printf("Part 1: %d\n", len(res))
-	fmt.Printf("Part 2: %d\n", len(res2))
+	if *printStep >= 0 {
+		w := bufio.NewWriter(os.Stdout)
+		if _, err := io.Copy(w, NewLookAndSayReader(strings.NewReader(seed), *printStep)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintln(w)
+		w.Flush()
+		return
+	}
+	if *statsStep >= 0 {
+		res, err := Statistics(strings.NewReader(seed), *statsStep)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeStats(os.Stdout, res)
+		return
+	}
+	if *steps > 0 {
+		fmt.Println(LengthAfter(seed, *steps))
+		return
+	}
+	fmt.Printf("Part 1: %d\n", LengthAfter(seed, 40))
+	fmt.Printf("Part 2: %d\n", LengthAfter(seed, 50))
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// stage is one look-and-say step over a stream. It holds at most one run's
+// output at a time on top of its input buffer.
+type stage struct {
+	src     *bufio.Reader
+	digit   byte
+	count   int64
+	pending []byte
+	done    bool
+}
+
+func (s *stage) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) > 0 {
+			k := copy(p[n:], s.pending)
+			s.pending = s.pending[k:]
+			n += k
+			continue
+		}
+		if s.done {
+			break
+		}
+		b, err := s.src.ReadByte()
+		if err == io.EOF {
+			s.done = true
+			s.flush()
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if s.count > 0 && b == s.digit {
+			s.count++
+			continue
+		}
+		s.flush()
+		s.digit, s.count = b, 1
+	}
+	if n == 0 && s.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *stage) flush() {
+	if s.count > 0 {
+		s.pending = strconv.AppendInt(s.pending[:0], s.count, 10)
+		s.pending = append(s.pending, s.digit)
+		s.count = 0
+	}
+}
+
+// NewLookAndSayReader streams the sequence n steps on from whatever seed
+// holds, without ever holding a whole step in memory. Every step is a small
+// buffer reading from the step before.
+func NewLookAndSayReader(seed io.Reader, n int) io.Reader {
+	r := seed
+	for i := 0; i < n; i++ {
+		r = &stage{src: bufio.NewReader(r)}
+	}
+	return r
+}
+
+// Stats describes one step of the sequence.
+type Stats struct {
+	Step   int
+	Length int64
+	Digits [10]int64
+	Runs   int64
+	// RunLengths counts how many runs there are of each length
+	RunLengths map[int64]int64
+}
+
+func (s Stats) LongestRun() int64 {
+	longest := int64(0)
+	for l := range s.RunLengths {
+		if l > longest {
+			longest = l
+		}
+	}
+	return longest
+}
+
+// observer passes a stream through while gathering Stats about it.
+type observer struct {
+	r     io.Reader
+	stats Stats
+	last  byte
+	run   int64
+}
+
+func (o *observer) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	for _, b := range p[:n] {
+		o.stats.Length++
+		if b >= '0' && b <= '9' {
+			o.stats.Digits[b-'0']++
+		}
+		if o.run > 0 && b == o.last {
+			o.run++
+			continue
+		}
+		o.endRun()
+		o.last, o.run = b, 1
+	}
+	if err == io.EOF {
+		o.endRun()
+	}
+	return n, err
+}
+
+func (o *observer) endRun() {
+	if o.run > 0 {
+		o.stats.Runs++
+		o.stats.RunLengths[o.run]++
+		o.run = 0
+	}
+}
+
+// Statistics gathers Stats for every step from 0 to n in one pass over the
+// streams, so it needs no more memory than NewLookAndSayReader does.
+func Statistics(seed io.Reader, n int) ([]Stats, error) {
+	observers := make([]*observer, n+1)
+	var r io.Reader = seed
+	for i := 0; i <= n; i++ {
+		if i > 0 {
+			r = &stage{src: bufio.NewReader(r)}
+		}
+		observers[i] = &observer{r: r, stats: Stats{Step: i, RunLengths: make(map[int64]int64)}}
+		r = observers[i]
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+
+	var res []Stats
+	for _, o := range observers {
+		res = append(res, o.stats)
+	}
+	return res, nil
+}
+
+func writeStats(w io.Writer, stats []Stats) error {
+	out := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(out, "step\tlength\t1s\t2s\t3s\tother\truns\tlongest\trun lengths\t")
+	for _, s := range stats {
+		other := s.Length - s.Digits[1] - s.Digits[2] - s.Digits[3]
+		var lengths []int64
+		for l := range s.RunLengths {
+			lengths = append(lengths, l)
+		}
+		sort.Slice(lengths, func(i, j int) bool { return lengths[i] < lengths[j] })
+		var hist []string
+		for _, l := range lengths {
+			hist = append(hist, fmt.Sprintf("%d:%d", l, s.RunLengths[l]))
+		}
+		fmt.Fprintf(out, "%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+			s.Step, s.Length, s.Digits[1], s.Digits[2], s.Digits[3], other, s.Runs, s.LongestRun(), strings.Join(hist, " "))
+	}
+	return out.Flush()
+}
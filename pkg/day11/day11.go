@@ -2,81 +2,60 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"log"
 	"os"
-	"strings"
 )
 
-func increment(s string) string {
-	chars := make([]byte, len(s))
-	carry := byte(1)
-	for i := len(s) - 1; i >= 0; i-- {
-		c := s[i] + carry
-		carry = 0
-		if c > 'z' {
-			carry = 1
-			c = 'a'
-		}
-
-		// Illegal character - skip forward
-		if c == 'i' || c == 'o' || c == 'l' {
-			c++
-			for j := i + 1; j < len(chars); j++ {
-				chars[j] = 'a'
-			}
-		}
-
-		chars[i] = c
-	}
-
-	sb := strings.Builder{}
-	if carry == 1 {
-		sb.WriteByte('a')
-	}
-
-	for _, c := range chars {
-		sb.WriteByte(c)
-	}
-	return sb.String()
-}
-
-func passes(s string) bool {
-	hasStraight := false
-	pairs := make(map[byte]int)
-
-	for i := 0; i < len(s)-2; i++ {
-		c0, c1, c2 := s[i], s[i+1], s[i+2]
-
-		// Run of three consecutive letters
-		if c0 == c1-1 && c1 == c2-1 {
-			hasStraight = true
-		}
+var (
+	policySpec = flag.String("policy", "", "use this policy instead of the puzzle's, like alphabet=a-z,forbid=iol,straight=3,pairs=2,length=8")
+	validate   = flag.Bool("validate", false, "say why each password breaks the policy instead of finding the next ones")
+	nth        = flag.Int("nth", 0, "print the nth valid password after each one instead of the puzzle's answers")
+)
 
-		// Need at least two different pairs
-		if c0 == c1 {
-			pairs[c0]++
-		} else if i == len(s)-3 && c1 == c2 {
-			pairs[c1]++
+func main() {
+	flag.Parse()
+	policy := santaPolicy()
+	if *policySpec != "" {
+		var err error
+		if policy, err = parsePolicy(*policySpec); err != nil {
+			log.Fatal(err)
 		}
 	}
 
-	return hasStraight && len(pairs) >= 2
-}
-
-func main() {
 	scanner := bufio.NewScanner(os.Stdin)
-
 	for scanner.Scan() {
 		password := scanner.Text()
-		for !passes(password) {
-			password = increment(password)
+		if *validate {
+			violations := policy.Validate(password)
+			if len(violations) == 0 {
+				fmt.Printf("%s: ok\n", password)
+			}
+			for _, v := range violations {
+				fmt.Printf("%s: %s\n", password, v)
+			}
+			continue
+		}
+		if *nth > 0 {
+			pw, err := policy.NextN(password, *nth)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: %s\n", password, pw)
+			continue
+		}
+
+		part1, err := policy.Next(password)
+		if err != nil {
+			log.Fatal(err)
 		}
-		fmt.Printf("Part 1: %s\n", password)
+		fmt.Printf("Part 1: %s\n", part1)
 
-		password = increment(password)
-		for !passes(password) {
-			password = increment(password)
+		part2, err := policy.Next(part1)
+		if err != nil {
+			log.Fatal(err)
 		}
-		fmt.Printf("Part 2: %s\n", password)
+		fmt.Printf("Part 2: %s\n", part2)
 	}
 }
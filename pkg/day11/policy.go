@@ -0,0 +1,507 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrNoPassword = errors.New("no valid password left")
+
+// Rule is one requirement of a password policy.
+type Rule struct {
+	Name string
+	// check returns why pw breaks the rule, or "" if it doesn't
+	check func(p *Policy, pw []byte) string
+	// forbid lists characters the rule never allows, so searches can skip
+	// them entirely
+	forbid string
+	// need is a lower bound on how many more characters after prefix it
+	// takes to satisfy the rule in a password total long, or impossible if
+	// none will. Rules without one are only checked on whole passwords.
+	need func(p *Policy, prefix []byte, total int) int
+	// state sums up everything about prefix that decides which endings
+	// satisfy the rule, so a search can skip endings that already failed
+	// after another prefix with the same state. Searches try every ending
+	// if any rule doesn't have one.
+	state func(p *Policy, prefix []byte) string
+}
+
+const impossible = math.MaxInt32
+
+// Violation is a rule a password breaks and why.
+type Violation struct {
+	Rule   string
+	Reason string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Reason)
+}
+
+// Policy is an alphabet and the rules a password over it has to follow.
+// Passwords are ordered like numbers written in the alphabet, so the next
+// password after one is what counting up gives.
+type Policy struct {
+	alphabet string
+	rules    []Rule
+	// symbols is the alphabet without any forbidden characters, in order,
+	// which is all a search ever has to try
+	symbols []byte
+	// index is each character's position in the alphabet, or -1
+	index [256]int
+}
+
+func NewPolicy(alphabet string, rules ...Rule) *Policy {
+	p := &Policy{alphabet: alphabet}
+	for i := range p.index {
+		p.index[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		p.index[alphabet[i]] = i
+	}
+	p.rules = append([]Rule{inAlphabet()}, rules...)
+	for i := 0; i < len(alphabet); i++ {
+		if !p.forbidden(alphabet[i]) {
+			p.symbols = append(p.symbols, alphabet[i])
+		}
+	}
+	return p
+}
+
+func (p *Policy) forbidden(c byte) bool {
+	for _, rule := range p.rules {
+		if strings.IndexByte(rule.forbid, c) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate lists every rule pw breaks.
+func (p *Policy) Validate(pw string) []Violation {
+	var res []Violation
+	for _, rule := range p.rules {
+		if reason := rule.check(p, []byte(pw)); reason != "" {
+			res = append(res, Violation{rule.Name, reason})
+		}
+	}
+	return res
+}
+
+func (p *Policy) valid(pw []byte) bool {
+	for _, rule := range p.rules {
+		if rule.check(p, pw) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) Valid(pw string) bool {
+	return p.valid([]byte(pw))
+}
+
+// Next finds the first valid password after pw of the same length. Rather
+// than counting up one password at a time, it looks for the rightmost
+// character it can raise and still finish the password validly, then builds
+// the smallest valid ending after it.
+func (p *Policy) Next(pw string) (string, error) {
+	cur := []byte(pw)
+	failed := make(map[string]bool)
+	// Nothing can keep a character that isn't allowed, so it's the last
+	// one worth raising
+	last := len(cur) - 1
+	for i, c := range cur {
+		if !p.isSymbol(c) {
+			last = i
+			break
+		}
+	}
+	for i := last; i >= 0; i-- {
+		for _, c := range p.symbols {
+			if p.index[c] <= p.index[cur[i]] {
+				continue
+			}
+			cur[i] = c
+			if p.complete(cur, i+1, failed) {
+				return string(cur), nil
+			}
+		}
+		cur[i] = pw[i]
+	}
+	return "", fmt.Errorf("%w after %s", ErrNoPassword, pw)
+}
+
+// NextN is the nth valid password after pw.
+func (p *Policy) NextN(pw string, n int) (string, error) {
+	for i := 0; i < n; i++ {
+		var err error
+		if pw, err = p.Next(pw); err != nil {
+			return "", err
+		}
+	}
+	return pw, nil
+}
+
+// complete fills pw[from:] with the smallest characters that make pw
+// valid, if any do. failed holds the states of prefixes no ending
+// completes.
+func (p *Policy) complete(pw []byte, from int, failed map[string]bool) bool {
+	if !p.feasible(pw, from) {
+		return false
+	}
+	if from == len(pw) {
+		return p.valid(pw)
+	}
+	key, ok := p.searchState(pw[:from])
+	if ok && failed[key] {
+		return false
+	}
+	for _, c := range p.symbols {
+		pw[from] = c
+		if p.complete(pw, from+1, failed) {
+			return true
+		}
+	}
+	if ok {
+		failed[key] = true
+	}
+	return false
+}
+
+// searchState is every rule's state after prefix, or false if a rule
+// doesn't have one.
+func (p *Policy) searchState(prefix []byte) (string, bool) {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(len(prefix)))
+	for _, rule := range p.rules {
+		if rule.state == nil {
+			return "", false
+		}
+		sb.WriteByte('|')
+		sb.WriteString(rule.state(p, prefix))
+	}
+	return sb.String(), true
+}
+
+// feasible reports whether some ending after pw[:from] could possibly make
+// pw valid.
+func (p *Policy) feasible(pw []byte, from int) bool {
+	for _, rule := range p.rules {
+		if rule.need != nil && rule.need(p, pw[:from], len(pw)) > len(pw)-from {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) isSymbol(c byte) bool {
+	return p.index[c] >= 0 && !p.forbidden(c)
+}
+
+// brokenState is the state for rules that look at each character on its
+// own, where all that matters about a prefix is whether it breaks them
+// already.
+func brokenState(check func(p *Policy, pw []byte) string) func(p *Policy, prefix []byte) string {
+	return func(p *Policy, prefix []byte) string {
+		if check(p, prefix) != "" {
+			return "broken"
+		}
+		return ""
+	}
+}
+
+func inAlphabet() Rule {
+	check := func(p *Policy, pw []byte) string {
+		for i, c := range pw {
+			if p.index[c] < 0 {
+				return fmt.Sprintf("%q at %d isn't one of %q", c, i, p.alphabet)
+			}
+		}
+		return ""
+	}
+	return Rule{
+		Name:  "alphabet",
+		check: check,
+		state: brokenState(check),
+	}
+}
+
+func forbidChars(chars string) Rule {
+	check := func(p *Policy, pw []byte) string {
+		for i, c := range pw {
+			if strings.IndexByte(chars, c) >= 0 {
+				return fmt.Sprintf("%q at %d isn't allowed", c, i)
+			}
+		}
+		return ""
+	}
+	return Rule{
+		Name:   "forbidden",
+		forbid: chars,
+		check:  check,
+		state:  brokenState(check),
+	}
+}
+
+// straight requires k characters in a row that are next to each other in
+// the alphabet, going up.
+func straight(k int) Rule {
+	return Rule{
+		Name: "straight",
+		check: func(p *Policy, pw []byte) string {
+			if longest, _ := straights(p, pw); longest >= k {
+				return ""
+			}
+			return fmt.Sprintf("needs %d increasing letters in a row", k)
+		},
+		need: func(p *Policy, prefix []byte, total int) int {
+			longest, tail := straights(p, prefix)
+			if longest >= k {
+				return 0
+			}
+			need := impossible
+			if p.canCount(prefix[len(prefix)-tail:], k) {
+				need = k - tail
+			}
+			if k < need && p.hasStraight(k) {
+				need = k
+			}
+			return need
+		},
+		// Only the straight the prefix ends with can carry on
+		state: func(p *Policy, prefix []byte) string {
+			longest, tail := straights(p, prefix)
+			if longest >= k {
+				return "done"
+			}
+			if len(prefix) == 0 {
+				return ""
+			}
+			return string(prefix[len(prefix)-1]) + strconv.Itoa(tail)
+		},
+	}
+}
+
+// straights is the longest straight in pw and the one it ends with.
+func straights(p *Policy, pw []byte) (longest int, tail int) {
+	for i := range pw {
+		if i > 0 && p.index[pw[i]] >= 0 && p.index[pw[i]] == p.index[pw[i-1]]+1 {
+			tail++
+		} else {
+			tail = 1
+		}
+		if tail > longest {
+			longest = tail
+		}
+	}
+	return longest, tail
+}
+
+// canCount reports whether the straight run can be carried on with allowed
+// characters until it's k long.
+func (p *Policy) canCount(run []byte, k int) bool {
+	if len(run) == 0 {
+		return false
+	}
+	start := p.index[run[0]]
+	if start < 0 || start+k > len(p.alphabet) {
+		return false
+	}
+	for i := len(run); i < k; i++ {
+		if p.forbidden(p.alphabet[start+i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasStraight reports whether the alphabet has k allowed characters in a
+// row anywhere.
+func (p *Policy) hasStraight(k int) bool {
+	run := 0
+	for i := 0; i < len(p.alphabet); i++ {
+		if p.forbidden(p.alphabet[i]) {
+			run = 0
+		} else {
+			run++
+		}
+		if run >= k {
+			return true
+		}
+	}
+	return false
+}
+
+// distinctPairs requires n non-overlapping pairs of different letters, like
+// aa and bb.
+func distinctPairs(n int) Rule {
+	return Rule{
+		Name: "pairs",
+		check: func(p *Policy, pw []byte) string {
+			if got, _ := countPairs(pw); got < n {
+				return fmt.Sprintf("needs %d different pairs, has %d", n, got)
+			}
+			return ""
+		},
+		need: func(p *Policy, prefix []byte, total int) int {
+			got, open := countPairs(prefix)
+			if got >= n {
+				return 0
+			}
+			if n > len(p.symbols) {
+				return impossible
+			}
+			// The last character can pair with the next one
+			need := 2 * (n - got)
+			if open {
+				need--
+			}
+			return need
+		},
+		// Which letters are paired matters, as pairing one again doesn't
+		// count, and so does a last character that's free to pair
+		state: func(p *Policy, prefix []byte) string {
+			seen, free := pairing(prefix)
+			if len(seen) >= n {
+				return "done"
+			}
+			var sb strings.Builder
+			for i := 0; i < len(p.alphabet); i++ {
+				if seen[p.alphabet[i]] {
+					sb.WriteByte(p.alphabet[i])
+				}
+			}
+			if free {
+				sb.WriteByte('+')
+				sb.WriteByte(prefix[len(prefix)-1])
+			}
+			return sb.String()
+		},
+	}
+}
+
+// countPairs is how many different letters pw has pairs of, and whether
+// its last character is left over to start another pair.
+func countPairs(pw []byte) (int, bool) {
+	seen, free := pairing(pw)
+	return len(seen), free && !seen[pw[len(pw)-1]]
+}
+
+// pairing is the letters pw has pairs of, taking pairs from the left, and
+// whether its last character isn't part of one.
+func pairing(pw []byte) (seen map[byte]bool, free bool) {
+	seen = make(map[byte]bool)
+	for i := 0; i < len(pw); i++ {
+		if i+1 < len(pw) && pw[i] == pw[i+1] {
+			seen[pw[i]] = true
+			i++
+			continue
+		}
+		free = i == len(pw)-1
+	}
+	return seen, free
+}
+
+// length requires between min and max characters. A max of 0 means no
+// limit.
+func length(min, max int) Rule {
+	return Rule{
+		Name: "length",
+		need: func(p *Policy, prefix []byte, total int) int {
+			// Searches never change the length, so it's decided before any
+			// characters are
+			if total < min || max > 0 && total > max {
+				return impossible
+			}
+			return 0
+		},
+		state: func(p *Policy, prefix []byte) string {
+			return ""
+		},
+		check: func(p *Policy, pw []byte) string {
+			switch {
+			case len(pw) < min:
+				return fmt.Sprintf("%d characters is shorter than %d", len(pw), min)
+			case max > 0 && len(pw) > max:
+				return fmt.Sprintf("%d characters is longer than %d", len(pw), max)
+			}
+			return ""
+		},
+	}
+}
+
+// santaPolicy is the puzzle's rules.
+func santaPolicy() *Policy {
+	return NewPolicy("abcdefghijklmnopqrstuvwxyz", forbidChars("iol"), straight(3), distinctPairs(2))
+}
+
+// parsePolicy reads a policy like
+//
+//	alphabet=a-z,forbid=iol,straight=3,pairs=2,length=8-32
+//
+// where every part is optional and the alphabet defaults to a-z.
+func parsePolicy(spec string) (*Policy, error) {
+	alphabet := "abcdefghijklmnopqrstuvwxyz"
+	var rules []Rule
+	for _, part := range strings.Split(spec, ",") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("policy part %q should look like key=value", part)
+		}
+		switch key {
+		case "alphabet":
+			alphabet = expandRanges(value)
+		case "forbid":
+			rules = append(rules, forbidChars(value))
+		case "straight", "pairs":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("policy part %q needs a number", part)
+			}
+			if key == "straight" {
+				rules = append(rules, straight(n))
+			} else {
+				rules = append(rules, distinctPairs(n))
+			}
+		case "length":
+			lo, hi, _ := strings.Cut(value, "-")
+			min, err := strconv.Atoi(lo)
+			if err != nil {
+				return nil, fmt.Errorf("policy part %q needs a length like 8 or 8-32", part)
+			}
+			max := min
+			if hi != "" {
+				if max, err = strconv.Atoi(hi); err != nil {
+					return nil, fmt.Errorf("policy part %q needs a length like 8 or 8-32", part)
+				}
+			}
+			rules = append(rules, length(min, max))
+		default:
+			return nil, fmt.Errorf("unknown policy rule %q", key)
+		}
+	}
+	return NewPolicy(alphabet, rules...), nil
+}
+
+// expandRanges turns a-z0-9 into the characters it covers.
+func expandRanges(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i+2 < len(s) && s[i+1] == '-' {
+			for c := int(s[i]); c <= int(s[i+2]); c++ {
+				sb.WriteByte(byte(c))
+			}
+			i += 2
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
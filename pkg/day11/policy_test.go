@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// passwords lists every password of length n over alphabet in order.
+func passwords(alphabet string, n int) []string {
+	res := []string{""}
+	for i := 0; i < n; i++ {
+		var next []string
+		for _, pw := range res {
+			for j := 0; j < len(alphabet); j++ {
+				next = append(next, pw+alphabet[j:j+1])
+			}
+		}
+		res = next
+	}
+	return res
+}
+
+// TestNextBruteForce checks Next against counting up one password at a
+// time, on alphabets small enough to try every password.
+func TestNextBruteForce(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		n    int
+	}{
+		{"alphabet=a-e,straight=3,pairs=2", 6},
+		{"alphabet=a-f,forbid=c,straight=3,pairs=2", 6},
+		{"alphabet=a-d,straight=2,pairs=3", 7},
+		{"alphabet=a-e,forbid=b,pairs=2,length=5-6", 6},
+		{"alphabet=a-c,straight=3,pairs=2,length=7", 6},
+	} {
+		p, err := parsePolicy(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all := passwords(p.alphabet, tc.n)
+		// want[i] is the first valid password after all[i], or "" if
+		// there isn't one
+		want := make([]string, len(all))
+		next := ""
+		for i := len(all) - 1; i >= 0; i-- {
+			want[i] = next
+			if p.Valid(all[i]) {
+				next = all[i]
+			}
+		}
+		for i, pw := range all {
+			got, err := p.Next(pw)
+			switch {
+			case want[i] == "" && !errors.Is(err, ErrNoPassword):
+				t.Fatalf("%s: Next(%s) = %q, %v, want ErrNoPassword", tc.spec, pw, got, err)
+			case want[i] != "" && (err != nil || got != want[i]):
+				t.Fatalf("%s: Next(%s) = %q, %v, want %s", tc.spec, pw, got, err, want[i])
+			}
+		}
+	}
+}
+
+// TestNextCompetingRules has rules that fight over the same characters,
+// which makes the search try a lot of endings that fail the same way.
+func TestNextCompetingRules(t *testing.T) {
+	for _, tc := range []struct {
+		spec, pw, want string
+	}{
+		{"straight=5,pairs=4", "hxbxwxbahxbxwxbahxbx", "hxbxwxbahxxaabbcdeff"},
+		{"forbid=iol,straight=6,pairs=5", "hxbxwxbahxbxwxbahxbxwxba", "hxbxwxbahxccaabbcdefggdd"},
+	} {
+		p, err := parsePolicy(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := p.Next(tc.pw); err != nil || got != tc.want {
+			t.Errorf("%s: Next(%s) = %q, %v, want %s", tc.spec, tc.pw, got, err, tc.want)
+		}
+	}
+}
@@ -2,45 +2,76 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"flag"
 	"fmt"
+	"log"
 	"os"
 )
 
-func sum(m any, ignoreRed bool) int {
-	s := 0
-	switch m := m.(type) {
-	case float64:
-		s = int(m)
-	case []any:
-		for _, v := range m {
-			s += sum(v, ignoreRed)
-		}
-	case map[string]any:
-		for k, v := range m {
-			if ignoreRed && (k == "red" || v == "red") {
-				return 0
-			}
-			s += sum(v, ignoreRed)
-		}
-	case string:
-		// empty
-	default:
-		panic(fmt.Sprintf("Unknown type for %+v\n", m))
+var (
+	filterSpec = flag.String("filter", "value=red", "objects to leave out of part 2, like value=red, key=red or path=a/*/b, or several separated by commas")
+	format     = flag.String("format", "json", "what the input is written in: json, yaml, toml or msgpack")
+	query      = flag.String("query", "", "print the numbers a JSONPath like $..a[*] or $[?(@.color != 'red')] matches, and their sum, count, min and max")
+)
+
+func main() {
+	flag.Parse()
+	in, err := input()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *query != "" {
+		runQuery(in)
+		return
 	}
 
-	return s
-}
+	filter, err := parseFilter(*filterSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func main() {
-	scanner := bufio.NewScanner(os.Stdin)
+	sums, err := Sum(in, noFilter, filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Part 1: %s\n", formatDecimal(sums[0]))
+	fmt.Printf("Part 2: %s\n", formatDecimal(sums[1]))
+}
 
-	var m any
-	for scanner.Scan() {
-		line := scanner.Text()
-		json.Unmarshal([]byte(line), &m)
+// input is stdin as tokens. JSON is streamed, but the other formats are
+// read into memory first.
+func input() (tokenReader, error) {
+	in := bufio.NewReaderSize(os.Stdin, 1<<20)
+	if *format == "json" {
+		return jsonTokens(in), nil
+	}
+	read, ok := formats[*format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", *format)
 	}
+	docs, err := read(in)
+	if err != nil {
+		return nil, err
+	}
+	return documentTokens(docs), nil
+}
 
-	fmt.Printf("Part 1: %d\n", sum(m, false))
-	fmt.Printf("Part 2: %d\n", sum(m, true))
+func runQuery(in tokenReader) {
+	q, err := ParseQuery(*query)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	summary, err := q.Run(in, func(m Match) {
+		fmt.Fprintf(out, "%s\t%s\n", m.Path, m.Value)
+	})
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+	fmt.Fprintf(out, "count: %d\nsum: %s\n", summary.Count, formatDecimal(summary.Sum))
+	if summary.Count > 0 {
+		fmt.Fprintf(out, "min: %s\nmax: %s\n", formatDecimal(summary.Min), formatDecimal(summary.Max))
+	}
 }
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+	"gopkg.in/yaml.v3"
+)
+
+// formats read a whole input into documents. JSON isn't here since it's
+// streamed instead.
+var formats = map[string]func(r io.Reader) ([]*Node, error){
+	"yaml":    readYAML,
+	"toml":    readTOML,
+	"msgpack": readMsgpack,
+}
+
+// readYAML reads every document in a YAML stream. Anchors and merge keys
+// are expanded, and numbers are read from their text so they stay exact.
+func readYAML(r io.Reader) ([]*Node, error) {
+	dec := yaml.NewDecoder(r)
+	var docs []*Node
+	total := 0
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := &yamlConverter{done: make(map[*yaml.Node]converted), tokens: make(map[*Node]int)}
+		n, err := c.convert(&doc, 0)
+		if err != nil {
+			return nil, err
+		}
+		if total += n.tokens; total > maxYAMLTokens {
+			return nil, errTooBig
+		}
+		docs = append(docs, n.node)
+	}
+}
+
+// maxYAMLDepth stops runaway nesting, and maxYAMLTokens stops aliases that
+// repeat each other from expanding into more than can be summed.
+const (
+	maxYAMLDepth  = 1000
+	maxYAMLTokens = 10_000_000
+)
+
+var errTooBig = fmt.Errorf("document expands to more than %d tokens", maxYAMLTokens)
+
+// converted is a YAML node as a Node, along with how many tokens it will
+// expand to.
+type converted struct {
+	node   *Node
+	tokens int
+}
+
+// yamlConverter turns yaml.Nodes into Nodes. Every alias to the same anchor
+// shares one Node, so only the tokens ever get expanded.
+type yamlConverter struct {
+	done   map[*yaml.Node]converted
+	tokens map[*Node]int
+}
+
+func (c *yamlConverter) convert(y *yaml.Node, depth int) (converted, error) {
+	if res, ok := c.done[y]; ok {
+		return res, nil
+	}
+	res, err := c.convertNew(y, depth)
+	if err != nil {
+		return converted{}, err
+	}
+	if res.tokens > maxYAMLTokens {
+		return converted{}, errTooBig
+	}
+	c.done[y] = res
+	c.tokens[res.node] = res.tokens
+	return res, nil
+}
+
+func (c *yamlConverter) convertNew(y *yaml.Node, depth int) (converted, error) {
+	if depth > maxYAMLDepth {
+		return converted{}, fmt.Errorf("line %d: nested too deep", y.Line)
+	}
+	switch y.Kind {
+	case yaml.DocumentNode:
+		if len(y.Content) == 0 {
+			return converted{scalar(nil), 1}, nil
+		}
+		return c.convert(y.Content[0], depth+1)
+	case yaml.AliasNode:
+		return c.convert(y.Alias, depth+1)
+	case yaml.SequenceNode:
+		res := converted{&Node{Kind: ArrayNode}, 2}
+		for _, item := range y.Content {
+			v, err := c.convert(item, depth+1)
+			if err != nil {
+				return converted{}, err
+			}
+			res.node.Items = append(res.node.Items, v.node)
+			res.tokens += v.tokens
+		}
+		return res, nil
+	case yaml.MappingNode:
+		res := converted{&Node{Kind: ObjectNode}, 2}
+		var merged []Field
+		for i := 0; i+1 < len(y.Content); i += 2 {
+			k, v := y.Content[i], y.Content[i+1]
+			value, err := c.convert(v, depth+1)
+			if err != nil {
+				return converted{}, err
+			}
+			if k.ShortTag() == "!!merge" {
+				merged = append(merged, mergeFields(value.node)...)
+				continue
+			}
+			if k.Kind != yaml.ScalarNode {
+				return converted{}, fmt.Errorf("line %d: only scalar keys are supported", k.Line)
+			}
+			res.node.Fields = append(res.node.Fields, Field{k.Value, value.node})
+			res.tokens += 1 + value.tokens
+		}
+		// Keys the mapping has itself win over merged ones
+		for _, f := range merged {
+			if !hasField(res.node, f.Key) {
+				res.node.Fields = append(res.node.Fields, f)
+				res.tokens += 1 + c.tokens[f.Value]
+			}
+		}
+		return res, nil
+	}
+
+	switch y.ShortTag() {
+	case "!!null":
+		return converted{scalar(nil), 1}, nil
+	case "!!bool":
+		var b bool
+		if err := y.Decode(&b); err != nil {
+			return converted{}, err
+		}
+		return converted{scalar(b), 1}, nil
+	case "!!int", "!!float":
+		n, err := number(y.Value)
+		if err != nil {
+			return converted{}, fmt.Errorf("line %d: %w", y.Line, err)
+		}
+		return converted{scalar(n), 1}, nil
+	}
+	return converted{scalar(y.Value), 1}, nil
+}
+
+// mergeFields is what a << key brings in: a mapping's fields, or those of a
+// list of mappings with earlier ones first.
+func mergeFields(n *Node) []Field {
+	if n.Kind == ObjectNode {
+		return n.Fields
+	}
+	merged := &Node{Kind: ObjectNode}
+	for _, item := range n.Items {
+		for _, f := range mergeFields(item) {
+			if !hasField(merged, f.Key) {
+				merged.Fields = append(merged.Fields, f)
+			}
+		}
+	}
+	return merged.Fields
+}
+
+func hasField(n *Node, key string) bool {
+	for _, f := range n.Fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// readTOML reads a TOML document. TOML tables have no order, so their keys
+// come out sorted.
+func readTOML(r io.Reader) ([]*Node, error) {
+	var doc map[string]any
+	if err := toml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	n, err := fromValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return []*Node{n}, nil
+}
+
+// fromValue converts what decoding into an any gives.
+func fromValue(v any) (*Node, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		n := &Node{Kind: ObjectNode}
+		for _, k := range keys {
+			value, err := fromValue(v[k])
+			if err != nil {
+				return nil, err
+			}
+			n.Fields = append(n.Fields, Field{k, value})
+		}
+		return n, nil
+	case []any:
+		n := &Node{Kind: ArrayNode}
+		for _, item := range v {
+			value, err := fromValue(item)
+			if err != nil {
+				return nil, err
+			}
+			n.Items = append(n.Items, value)
+		}
+		return n, nil
+	case nil, bool, string:
+		return scalar(v), nil
+	case int64:
+		return scalar(json.Number(strconv.FormatInt(v, 10))), nil
+	case float64:
+		n, err := floatNumber(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return scalar(n), nil
+	case fmt.Stringer:
+		// Dates and times
+		return scalar(v.String()), nil
+	}
+	return nil, fmt.Errorf("can't handle %T", v)
+}
+
+// readMsgpack reads a stream of MessagePack values. Maps are read entry by
+// entry so they keep their order.
+func readMsgpack(r io.Reader) ([]*Node, error) {
+	dec := msgpack.NewDecoder(r)
+	var docs []*Node
+	for {
+		if _, err := dec.PeekCode(); err == io.EOF {
+			return docs, nil
+		}
+		n, err := fromMsgpack(dec)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, n)
+	}
+}
+
+func fromMsgpack(dec *msgpack.Decoder) (*Node, error) {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch {
+	case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+		size, err := dec.DecodeMapLen()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		n := &Node{Kind: ObjectNode}
+		for i := 0; i < size; i++ {
+			k, err := dec.DecodeInterface()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			key, err := msgpackScalar(k)
+			if err != nil || key.Kind != ScalarNode {
+				return nil, fmt.Errorf("can't use %v as a key", k)
+			}
+			value, err := fromMsgpack(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Fields = append(n.Fields, Field{fmt.Sprint(key.Value), value})
+		}
+		return n, nil
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		size, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		n := &Node{Kind: ArrayNode}
+		for i := 0; i < size; i++ {
+			item, err := fromMsgpack(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Items = append(n.Items, item)
+		}
+		return n, nil
+	}
+
+	v, err := dec.DecodeInterface()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return msgpackScalar(v)
+}
+
+// msgpackScalar converts anything but a map or array, which can be keys as
+// well as values.
+func msgpackScalar(v any) (*Node, error) {
+	switch v := v.(type) {
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		return scalar(json.Number(fmt.Sprint(v))), nil
+	case float32:
+		n, err := floatNumber(float64(v), 32)
+		if err != nil {
+			return nil, err
+		}
+		return scalar(n), nil
+	case []byte:
+		return scalar(string(v)), nil
+	case time.Time:
+		return scalar(v.Format(time.RFC3339Nano)), nil
+	}
+	return fromValue(v)
+}
+
+// unexpectedEOF is for running out of input part way through a value.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Query is a compiled JSONPath. It understands a subset that can be
+// answered in one pass over a stream:
+//
+//	$.a.b  $['a']  $.*  $[*]  $[0]  $..a  $..[*]  $[?(@.color != 'red')]
+//
+// Filters can compare @ or one of its direct fields (@.name or @['name'])
+// with a string, number, true, false or null using == != < <= > >=, test a
+// field is there with just @.name, and combine those with && || and
+// parentheses.
+type Query struct {
+	src      string
+	segments []segment
+}
+
+// segment is one step of a path: a selector picking children, either of the
+// current node or, for .., of it and everything under it.
+type segment struct {
+	descendant bool
+	wildcard   bool
+	name       *string
+	index      *int
+	filter     predicate
+}
+
+func (s *segment) selects(f *frame[*queryState]) bool {
+	switch {
+	case s.wildcard || s.filter != nil:
+		return true
+	case s.name != nil:
+		return f.obj && f.key == *s.name
+	case s.index != nil:
+		return !f.obj && f.index == *s.index
+	}
+	return false
+}
+
+// predicate tests a filter's @ against a value, given its fields if it's an
+// object.
+type predicate func(v json.Token, fields map[string]json.Token) bool
+
+// operand is one side of a comparison. ok is false when it refers to a
+// field that isn't there.
+type operand func(v json.Token, fields map[string]json.Token) (json.Token, bool)
+
+func ParseQuery(src string) (*Query, error) {
+	p := &queryParser{src: src}
+	q, err := p.query()
+	if err != nil {
+		return nil, fmt.Errorf("query %q: %w", src, err)
+	}
+	return q, nil
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) peek(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *queryParser) accept(s string) bool {
+	if p.peek(s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *queryParser) query() (*Query, error) {
+	q := &Query{src: p.src}
+	if !p.accept("$") {
+		return nil, p.errorf("queries start with $")
+	}
+	for p.pos < len(p.src) {
+		var seg segment
+		seg.descendant = p.accept("..")
+		var err error
+		switch {
+		case p.accept("["):
+			err = p.bracketSelector(&seg)
+		case seg.descendant || p.accept("."):
+			err = p.dotSelector(&seg)
+		default:
+			err = p.errorf("expected . or [")
+		}
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, seg)
+	}
+	return q, nil
+}
+
+func (p *queryParser) dotSelector(seg *segment) error {
+	if p.accept("*") {
+		seg.wildcard = true
+		return nil
+	}
+	name := p.name()
+	if name == "" {
+		return p.errorf("expected a name or *")
+	}
+	seg.name = &name
+	return nil
+}
+
+func (p *queryParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(".[]()@=!<>&| '\"", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *queryParser) bracketSelector(seg *segment) error {
+	p.skipSpace()
+	switch {
+	case p.accept("*"):
+		seg.wildcard = true
+	case p.peek("'") || p.peek("\""):
+		name, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		seg.name = &name
+	case p.accept("?"):
+		p.skipSpace()
+		if !p.accept("(") {
+			return p.errorf("filters look like ?(...)")
+		}
+		filter, err := p.or()
+		if err != nil {
+			return err
+		}
+		p.skipSpace()
+		if !p.accept(")") {
+			return p.errorf("expected )")
+		}
+		seg.filter = filter
+	default:
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '-' || p.src[p.pos] >= '0' && p.src[p.pos] <= '9') {
+			p.pos++
+		}
+		i, err := strconv.Atoi(p.src[start:p.pos])
+		if err != nil {
+			return p.errorf("expected *, a name, an index or a filter")
+		}
+		if i < 0 {
+			// Counting from the end needs the whole array first
+			return p.errorf("negative indexes aren't supported")
+		}
+		seg.index = &i
+	}
+	p.skipSpace()
+	if !p.accept("]") {
+		return p.errorf("expected ]")
+	}
+	return nil
+}
+
+func (p *queryParser) quoted() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return sb.String(), nil
+		case c == '\\' && p.pos < len(p.src):
+			sb.WriteByte(p.src[p.pos])
+			p.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *queryParser) or() (predicate, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.accept("||"); p.skipSpace() {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v json.Token, fields map[string]json.Token) bool {
+			return l(v, fields) || right(v, fields)
+		}
+	}
+	return left, nil
+}
+
+func (p *queryParser) and() (predicate, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.accept("&&"); p.skipSpace() {
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v json.Token, fields map[string]json.Token) bool {
+			return l(v, fields) && right(v, fields)
+		}
+	}
+	return left, nil
+}
+
+func (p *queryParser) comparison() (predicate, error) {
+	p.skipSpace()
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.accept(")") {
+			return nil, p.errorf("expected )")
+		}
+		return inner, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	var op string
+	for _, o := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		// On its own an operand tests that it's there
+		return func(v json.Token, fields map[string]json.Token) bool {
+			_, ok := left(v, fields)
+			return ok
+		}, nil
+	}
+	p.skipSpace()
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return func(v json.Token, fields map[string]json.Token) bool {
+		a, aok := left(v, fields)
+		b, bok := right(v, fields)
+		return compare(op, a, aok, b, bok)
+	}, nil
+}
+
+func (p *queryParser) operand() (operand, error) {
+	switch {
+	case p.accept("@"):
+		var name *string
+		switch {
+		case p.accept("."):
+			n := p.name()
+			if n == "" {
+				return nil, p.errorf("expected a field name after @.")
+			}
+			name = &n
+		case p.accept("["):
+			if !p.peek("'") && !p.peek("\"") {
+				return nil, p.errorf("expected a quoted field name after @[")
+			}
+			n, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept("]") {
+				return nil, p.errorf("expected ]")
+			}
+			name = &n
+		}
+		if p.peek(".") || p.peek("[") {
+			return nil, p.errorf("filters can only look at @ and its direct fields")
+		}
+		if name == nil {
+			return func(v json.Token, fields map[string]json.Token) (json.Token, bool) {
+				return v, true
+			}, nil
+		}
+		return func(v json.Token, fields map[string]json.Token) (json.Token, bool) {
+			tok, ok := fields[*name]
+			return tok, ok
+		}, nil
+	case p.peek("'") || p.peek("\""):
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return literal(s), nil
+	case p.accept("true"):
+		return literal(true), nil
+	case p.accept("false"):
+		return literal(false), nil
+	case p.accept("null"):
+		return literal(nil), nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("+-.0123456789eE", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	n := json.Number(p.src[start:p.pos])
+	if _, err := parseNumber(n); err != nil || start == p.pos {
+		p.pos = start
+		return nil, p.errorf("expected @, a string, a number, true, false or null")
+	}
+	return literal(n), nil
+}
+
+func literal(tok json.Token) operand {
+	return func(json.Token, map[string]json.Token) (json.Token, bool) {
+		return tok, true
+	}
+}
+
+// compare follows JSONPath's rules: missing values only equal each other,
+// values of different types are never equal or ordered, and objects and
+// arrays never compare equal to anything here since only their start is
+// known.
+func compare(op string, a json.Token, aok bool, b json.Token, bok bool) bool {
+	switch op {
+	case "==":
+		return equal(a, aok, b, bok)
+	case "!=":
+		return !equal(a, aok, b, bok)
+	case "<":
+		return less(a, aok, b, bok)
+	case ">":
+		return less(b, bok, a, aok)
+	case "<=":
+		return less(a, aok, b, bok) || equal(a, aok, b, bok)
+	case ">=":
+		return less(b, bok, a, aok) || equal(a, aok, b, bok)
+	}
+	return false
+}
+
+func equal(a json.Token, aok bool, b json.Token, bok bool) bool {
+	if !aok || !bok {
+		return aok == bok
+	}
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		return ok && cmpNumbers(a, b) == 0
+	case json.Delim:
+		return false
+	}
+	return a == b
+}
+
+func less(a json.Token, aok bool, b json.Token, bok bool) bool {
+	if !aok || !bok {
+		return false
+	}
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		return ok && cmpNumbers(a, b) < 0
+	case string:
+		b, ok := b.(string)
+		return ok && a < b
+	}
+	return false
+}
+
+func cmpNumbers(a, b json.Number) int {
+	x, _ := parseNumber(a)
+	y, _ := parseNumber(b)
+	return x.Cmp(y)
+}
+
+// Match is a number a query picked out, with where it is.
+type Match struct {
+	Path  string
+	Value json.Number
+}
+
+// Summary describes all the numbers a query matched.
+type Summary struct {
+	Count         int
+	Sum, Min, Max *big.Rat
+}
+
+func (s *Summary) add(v *big.Rat) {
+	s.Count++
+	s.Sum.Add(s.Sum, v)
+	if s.Min == nil || v.Cmp(s.Min) < 0 {
+		s.Min = v
+	}
+	if s.Max == nil || v.Cmp(s.Max) > 0 {
+		s.Max = v
+	}
+}
+
+// queryState is what a query keeps for each object and array it's in.
+type queryState struct {
+	// threads are the ways the query could go on to match something under
+	// here
+	threads []thread
+	// selected lists the conditions under which the query picked out this
+	// value or one it's inside of, any one of which is enough
+	selected [][]*condition
+	// conditions are the filters waiting on this object or array to end
+	conditions []*condition
+}
+
+// thread is a partial match: the segment it has got up to, and the filters
+// that have to pass on the way for it to count.
+type thread struct {
+	segment    int
+	conditions []*condition
+}
+
+// condition is a filter waiting on an object or array it can only decide
+// once it's seen all of its fields.
+type condition struct {
+	filter  predicate
+	decided bool
+	ok      bool
+}
+
+// pending is a number the query might match, once the conditions in one of
+// its alternatives are known to hold.
+type pending struct {
+	match        Match
+	alternatives [][]*condition
+}
+
+// decide reports whether the number is matched, and whether that's known
+// yet: it is once one alternative has passed or every one has failed.
+func (p *pending) decide() (matched, decided bool) {
+	open := false
+	for _, alt := range p.alternatives {
+		failed, waiting := false, false
+		for _, c := range alt {
+			failed = failed || c.decided && !c.ok
+			waiting = waiting || !c.decided
+		}
+		if !failed && !waiting {
+			return true, true
+		}
+		open = open || !failed
+	}
+	return false, !open
+}
+
+// Run goes through a stream of values, calling found on every number the
+// query picks out, either directly or by picking out an object or array it's
+// inside, in document order. Each top level value counts as $. A number is
+// passed on as soon as the filters it depends on are decided, but as found
+// is called in order, it's also held back by any earlier number that's
+// waiting. That keeps at most the numbers since the outermost object or
+// array with an undecided filter in memory.
+func (q *Query) Run(tokens tokenReader, found func(m Match)) (Summary, error) {
+	summary := Summary{Sum: new(big.Rat)}
+	var waiting []pending
+	flush := func() error {
+		done := 0
+		for ; done < len(waiting); done++ {
+			matched, decided := waiting[done].decide()
+			if !decided {
+				break
+			}
+			if !matched {
+				continue
+			}
+			v, err := parseNumber(waiting[done].match.Value)
+			if err != nil {
+				return err
+			}
+			summary.add(v)
+			found(waiting[done].match)
+		}
+		if done == len(waiting) {
+			waiting = waiting[:0]
+		} else {
+			waiting = waiting[done:]
+		}
+		return nil
+	}
+
+	err := walk(tokens, &queryState{}, visitor[*queryState]{
+		value: func(stack []*frame[*queryState], tok json.Token) (*queryState, error) {
+			state := q.enter(stack, tok)
+			if n, ok := tok.(json.Number); ok && len(state.selected) > 0 {
+				waiting = append(waiting, pending{Match{formatPath(stack), n}, state.selected})
+				return state, flush()
+			}
+			return state, nil
+		},
+		end: func(stack []*frame[*queryState]) error {
+			top := stack[len(stack)-1]
+			self := json.Delim('[')
+			if top.obj {
+				self = json.Delim('{')
+			}
+			for _, c := range top.state.conditions {
+				c.ok = c.filter(self, top.fields)
+				c.decided = true
+			}
+			if len(top.state.conditions) > 0 {
+				return flush()
+			}
+			return nil
+		},
+	})
+	return summary, err
+}
+
+// enter works out the query's state for a value starting inside the top of
+// stack.
+func (q *Query) enter(stack []*frame[*queryState], tok json.Token) *queryState {
+	parent := stack[len(stack)-1]
+	state := &queryState{selected: parent.state.selected}
+	if len(stack) == 1 {
+		// Top level values are the root
+		state.threads = []thread{{}}
+	} else {
+		_, container := tok.(json.Delim)
+		for _, t := range parent.state.threads {
+			seg := &q.segments[t.segment]
+			if seg.descendant {
+				state.threads = append(state.threads, t)
+			}
+			if !seg.selects(parent) {
+				continue
+			}
+			next := thread{segment: t.segment + 1, conditions: t.conditions}
+			if seg.filter != nil {
+				if !container {
+					if !seg.filter(tok, nil) {
+						continue
+					}
+				} else {
+					c := &condition{filter: seg.filter}
+					state.conditions = append(state.conditions, c)
+					next.conditions = append(append([]*condition(nil), t.conditions...), c)
+				}
+			}
+			state.threads = append(state.threads, next)
+		}
+	}
+
+	// Threads at the end of the query have matched, so everything in this
+	// value is picked out
+	live := state.threads[:0]
+	for _, t := range state.threads {
+		if t.segment < len(q.segments) {
+			live = append(live, t)
+			continue
+		}
+		state.selected = append(state.selected[:len(state.selected):len(state.selected)], t.conditions)
+	}
+	state.threads = live
+	return state
+}
+
+// formatPath writes where a value nested directly inside the top of stack
+// is the way JSONPath does, like $.a[0]['b c'].
+func formatPath(stack []*frame[*queryState]) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, f := range stack[1:] {
+		switch {
+		case !f.obj:
+			fmt.Fprintf(&sb, "[%d]", f.index)
+		case isIdentifier(f.key):
+			sb.WriteString(".")
+			sb.WriteString(f.key)
+		default:
+			sb.WriteString("['")
+			sb.WriteString(strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(f.key))
+			sb.WriteString("']")
+		}
+	}
+	return sb.String()
+}
+
+func isIdentifier(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// tokenReader is where a walk gets its tokens from, in the form
+// json.Decoder hands them out with UseNumber: json.Delim for the start and
+// end of objects and arrays, keys and strings as string, json.Number, bool
+// and nil.
+type tokenReader interface {
+	Token() (json.Token, error)
+}
+
+// jsonTokens streams JSON straight from r.
+func jsonTokens(r io.Reader) tokenReader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec
+}
+
+type NodeKind int
+
+const (
+	ScalarNode NodeKind = iota
+	ObjectNode
+	ArrayNode
+)
+
+// Node is a document read from any of the formats, as the objects, arrays
+// and scalars JSON has. Numbers are kept as json.Number so they stay exact.
+type Node struct {
+	Kind NodeKind
+	// Fields are an object's, in the order the document has them
+	Fields []Field
+	Items  []*Node
+	// Value is a scalar's: a string, json.Number, bool or nil
+	Value json.Token
+}
+
+type Field struct {
+	Key   string
+	Value *Node
+}
+
+func scalar(v json.Token) *Node {
+	return &Node{Kind: ScalarNode, Value: v}
+}
+
+// appendTokens adds the tokens a JSON decoder would give for n.
+func (n *Node) appendTokens(dst []json.Token) []json.Token {
+	switch n.Kind {
+	case ObjectNode:
+		dst = append(dst, json.Delim('{'))
+		for _, f := range n.Fields {
+			dst = append(dst, f.Key)
+			dst = f.Value.appendTokens(dst)
+		}
+		return append(dst, json.Delim('}'))
+	case ArrayNode:
+		dst = append(dst, json.Delim('['))
+		for _, item := range n.Items {
+			dst = item.appendTokens(dst)
+		}
+		return append(dst, json.Delim(']'))
+	}
+	return append(dst, n.Value)
+}
+
+// nodeTokens reads the tokens of a series of documents, so sums and queries
+// can run over them just as they do over a JSON stream.
+type nodeTokens struct {
+	tokens []json.Token
+}
+
+func documentTokens(docs []*Node) tokenReader {
+	t := &nodeTokens{}
+	for _, doc := range docs {
+		t.tokens = doc.appendTokens(t.tokens)
+	}
+	return t
+}
+
+func (t *nodeTokens) Token() (json.Token, error) {
+	if len(t.tokens) == 0 {
+		return nil, io.EOF
+	}
+	tok := t.tokens[0]
+	t.tokens = t.tokens[1:]
+	return tok, nil
+}
+
+// number turns the way a format writes a number into an exact json.Number.
+// It takes the underscores, 0x, 0o and 0b prefixes and leading dots or plus
+// signs YAML and TOML allow, but not infinities or NaN, which can't be summed.
+func number(text string) (json.Number, error) {
+	clean := strings.ReplaceAll(text, "_", "")
+	if i, ok := new(big.Int).SetString(clean, 0); ok {
+		return json.Number(i.String()), nil
+	}
+	r, ok := new(big.Rat).SetString(clean)
+	if !ok {
+		return "", fmt.Errorf("can't read %q as a number", text)
+	}
+	if json.Valid([]byte(clean)) {
+		return json.Number(clean), nil
+	}
+	return json.Number(formatDecimal(r)), nil
+}
+
+// floatNumber is the shortest decimal that reads back as f, which is what
+// whoever wrote it most likely meant.
+func floatNumber(f float64, bits int) (json.Number, error) {
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if strings.ContainsAny(s, "IN") {
+		return "", fmt.Errorf("can't sum %s", s)
+	}
+	return json.Number(s), nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Object is what a Filter gets to see of a JSON object: where it is and its
+// own fields. Fields holding objects or arrays only show their opening
+// json.Delim, since their contents have been summed and dropped by then.
+type Object struct {
+	// Path is the keys and array indexes leading to the object. It's only
+	// valid during the call to Match.
+	Path   []string
+	Fields map[string]json.Token
+}
+
+// Filter decides which objects to leave out of a sum, along with
+// everything inside them.
+type Filter struct {
+	Name  string
+	Match func(o *Object) bool
+}
+
+// noFilter sums everything.
+var noFilter = Filter{Name: "none", Match: func(*Object) bool { return false }}
+
+// valueIs drops objects with a string or number field equal to v. Keys
+// don't count, and neither do values in arrays.
+func valueIs(v string) Filter {
+	return Filter{
+		Name: "value=" + v,
+		Match: func(o *Object) bool {
+			for _, tok := range o.Fields {
+				switch tok := tok.(type) {
+				case string:
+					if tok == v {
+						return true
+					}
+				case json.Number:
+					if tok.String() == v {
+						return true
+					}
+				}
+			}
+			return false
+		},
+	}
+}
+
+func hasKey(k string) Filter {
+	return Filter{
+		Name: "key=" + k,
+		Match: func(o *Object) bool {
+			_, ok := o.Fields[k]
+			return ok
+		},
+	}
+}
+
+// pathMatches drops objects whose path, joined with slashes, matches
+// pattern the way path.Match does, so items/*/meta matches items/3/meta.
+func pathMatches(pattern string) (Filter, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return Filter{}, fmt.Errorf("bad path pattern %q: %w", pattern, err)
+	}
+	return Filter{
+		Name: "path=" + pattern,
+		Match: func(o *Object) bool {
+			ok, _ := path.Match(pattern, strings.Join(o.Path, "/"))
+			return ok
+		},
+	}, nil
+}
+
+func anyOf(filters ...Filter) Filter {
+	var names []string
+	for _, f := range filters {
+		names = append(names, f.Name)
+	}
+	return Filter{
+		Name: strings.Join(names, ","),
+		Match: func(o *Object) bool {
+			for _, f := range filters {
+				if f.Match(o) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// parseFilter reads filters like value=red, key=secret or path=a/*/b. Several
+// separated by commas drop objects any one of them matches.
+func parseFilter(spec string) (Filter, error) {
+	var filters []Filter
+	for _, part := range strings.Split(spec, ",") {
+		kind, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Filter{}, fmt.Errorf("filter %q should look like value=red, key=red or path=a/*", part)
+		}
+		switch kind {
+		case "value":
+			filters = append(filters, valueIs(value))
+		case "key":
+			filters = append(filters, hasKey(value))
+		case "path":
+			f, err := pathMatches(value)
+			if err != nil {
+				return Filter{}, err
+			}
+			filters = append(filters, f)
+		default:
+			return Filter{}, fmt.Errorf("unknown filter %q", kind)
+		}
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return anyOf(filters...), nil
+}
+
+// total is an exact running sum. Most numbers are small integers, so it
+// keeps those in an int64 and only turns to big.Rat when it has to.
+type total struct {
+	n int64
+	r *big.Rat
+}
+
+func (t *total) addInt(v int64) {
+	s := t.n + v
+	if (v > 0 && s < t.n) || (v < 0 && s > t.n) {
+		t.addRat(new(big.Rat).SetInt64(v))
+		return
+	}
+	t.n = s
+}
+
+func (t *total) addRat(v *big.Rat) {
+	if t.r == nil {
+		t.r = new(big.Rat)
+	}
+	t.r.Add(t.r, v)
+}
+
+func (t *total) add(o *total) {
+	t.addInt(o.n)
+	if o.r != nil {
+		t.addRat(o.r)
+	}
+}
+
+func (t *total) Rat() *big.Rat {
+	res := new(big.Rat).SetInt64(t.n)
+	if t.r != nil {
+		res.Add(res, t.r)
+	}
+	return res
+}
+
+// frame is an object or array the walk is inside of, along with the state
+// whoever is walking keeps for it.
+type frame[S any] struct {
+	obj    bool
+	fields map[string]json.Token
+	// key is the object's current key, and expectKey says whether the next
+	// token is a key or its value
+	key       string
+	expectKey bool
+	index     int
+	state     S
+}
+
+// set records a field of an object and moves on to the next key or element.
+func (f *frame[S]) set(tok json.Token) {
+	if f.obj {
+		f.fields[f.key] = tok
+		f.expectKey = true
+	} else {
+		f.index++
+	}
+}
+
+// segment is where the value nested directly inside f is, for paths.
+func (f *frame[S]) segment() string {
+	if f.obj {
+		return f.key
+	}
+	return strconv.Itoa(f.index)
+}
+
+// visitor is what a walk calls as it goes. Both get the stack of frames the
+// walk is inside of, with the bottom one standing for the top level of the
+// stream.
+type visitor[S any] struct {
+	// value is called as each value starts, and returns the state for it if
+	// it's an object or array
+	value func(stack []*frame[S], tok json.Token) (S, error)
+	// end is called as an object or array ends, while it's still on the
+	// stack
+	end func(stack []*frame[S]) error
+}
+
+// walk goes through a stream of values token by token, keeping only the
+// objects and arrays it's inside of in memory.
+func walk[S any](tokens tokenReader, root S, v visitor[S]) error {
+	stack := []*frame[S]{{state: root}}
+	for {
+		tok, err := tokens.Token()
+		if err == io.EOF {
+			if len(stack) > 1 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		top := stack[len(stack)-1]
+		if top.obj && top.expectKey {
+			if key, ok := tok.(string); ok {
+				top.key, top.expectKey = key, false
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('}'), json.Delim(']'):
+			if err := v.end(stack); err != nil {
+				return err
+			}
+			stack = stack[:len(stack)-1]
+			if top.obj {
+				stack[len(stack)-1].set(json.Delim('{'))
+			} else {
+				stack[len(stack)-1].set(json.Delim('['))
+			}
+			continue
+		}
+		state, err := v.value(stack, tok)
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame[S]{obj: true, fields: make(map[string]json.Token), expectKey: true, state: state})
+		case json.Delim('['):
+			stack = append(stack, &frame[S]{state: state})
+		default:
+			top.set(tok)
+		}
+	}
+}
+
+// pathTo is the path of a value nested directly inside the innermost of
+// stack.
+func pathTo[S any](stack []*frame[S]) []string {
+	var res []string
+	for _, f := range stack[1:] {
+		res = append(res, f.segment())
+	}
+	return res
+}
+
+// parseNumber reads a JSON number exactly.
+func parseNumber(n json.Number) (*big.Rat, error) {
+	v, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return nil, fmt.Errorf("can't read number %s", n)
+	}
+	return v, nil
+}
+
+// Sum adds up every number in a stream of values, once per filter, in a
+// single pass over it. Only the objects currently open are kept in
+// memory, so documents don't have to fit in it. Numbers are added exactly.
+func Sum(tokens tokenReader, filters ...Filter) ([]*big.Rat, error) {
+	// Every object keeps a running total per filter. Arrays share their
+	// parent's, since only objects ever get dropped.
+	root := make([]total, len(filters))
+	err := walk(tokens, root, visitor[[]total]{
+		value: func(stack []*frame[[]total], tok json.Token) ([]total, error) {
+			sums := stack[len(stack)-1].state
+			switch tok := tok.(type) {
+			case json.Delim:
+				if tok == '{' {
+					return make([]total, len(filters)), nil
+				}
+				return sums, nil
+			case json.Number:
+				if v, err := strconv.ParseInt(tok.String(), 10, 64); err == nil {
+					for i := range sums {
+						sums[i].addInt(v)
+					}
+					return nil, nil
+				}
+				v, err := parseNumber(tok)
+				if err != nil {
+					return nil, err
+				}
+				for i := range sums {
+					sums[i].addRat(v)
+				}
+			}
+			return nil, nil
+		},
+		end: func(stack []*frame[[]total]) error {
+			top, parent := stack[len(stack)-1], stack[len(stack)-2]
+			if !top.obj {
+				return nil
+			}
+			o := &Object{Path: pathTo(stack[:len(stack)-1]), Fields: top.fields}
+			for i, f := range filters {
+				if !f.Match(o) {
+					parent.state[i].add(&top.state[i])
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []*big.Rat
+	for i := range root {
+		res = append(res, root[i].Rat())
+	}
+	return res, nil
+}
+
+// formatDecimal writes r out in full. JSON numbers are all decimals, so
+// their sums always end.
+func formatDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	digits := 0
+	scale := big.NewInt(1)
+	for new(big.Int).Mod(scale, r.Denom()).Sign() != 0 {
+		scale.Mul(scale, big.NewInt(10))
+		digits++
+	}
+	return r.FloatString(digits)
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"golang.org/x/exp/constraints"
 )
@@ -35,44 +39,27 @@ func max[T constraints.Ordered](args ...T) T {
 	return m
 }
 
-func shortest(molecules map[string]int) string {
-	res := ""
-	for molecule := range molecules {
-		if res == "" || len(molecule) < len(res) {
-			res = molecule
-		}
-	}
-	return res
-}
-
 type Reaction struct {
 	from string
 	to   string
 }
 
-func minReplacementSteps(start, target string, replacements []Reaction) int {
-	// We start with the target moluecule and try to find the shortest path to the start
-	molecules := make(map[string]int)
-	molecules[target] = 0
-	for {
-		cur := shortest(molecules)
-		for _, replacement := range replacements {
-			for i := 0; i < len(cur)-len(replacement.to)+1; i++ {
-				if cur[i:i+len(replacement.to)] == replacement.to {
-					newMolecule := cur[:i] + replacement.from + cur[i+len(replacement.to):]
-					molecules[newMolecule] = molecules[cur] + 1
-					if newMolecule == start {
-						return molecules[newMolecule]
-					}
-				}
-			}
-		}
-		delete(molecules, cur)
-	}
-}
+var (
+	search    = flag.String("search", "", "find part 2 with a search strategy instead of CYK: "+strategyNames())
+	timeout   = flag.Duration("timeout", time.Minute, "give up searching after this long")
+	maxStates = flag.Int("max-states", 1_000_000, "give up searching after expanding this many molecules")
+	restarts  = flag.Int("restarts", 100, "restarts for the greedy search")
+	seed      = flag.Int64("seed", 1, "random seed for the greedy search")
+	progress  = flag.Bool("progress", false, "report search progress on stderr")
+	traceFmt  = flag.String("trace", "", "print the part 2 derivation as text or json")
+	verify    = flag.String("verify", "", "check a json trace from this file against the input instead of solving")
+)
 
 func main() {
+	flag.Parse()
 	scanner := bufio.NewScanner(os.Stdin)
+	// Molecules can be far longer than a default scanner line
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
 
 	var replacements []Reaction
 	var target string
@@ -92,17 +79,62 @@ func main() {
 		replacements = append(replacements, Reaction{from, to})
 	}
 
-	possibilities := make(map[string]Reaction)
-	for _, reaction := range replacements {
-		for i := 0; i < len(target)-len(reaction.from)+1; i++ {
-			if target[i:i+len(reaction.from)] == reaction.from {
-				possibilities[target[:i]+reaction.to+target[i+len(reaction.from):]] = reaction
-			}
+	grammar, err := NewGrammar(replacements)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *verify != "" {
+		f, err := os.Open(*verify)
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer f.Close()
+		t, err := ReadTrace(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := grammar.Verify(t, target); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Trace OK: %d steps\n", len(t.Steps))
+		return
 	}
 
-	fmt.Printf("Part 1: %d\n", len(possibilities))
+	distinct, err := grammar.CountDistinct(target)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Part 1: %d\n", distinct)
 
 	// Part 2
-	fmt.Printf("Part 2: %d\n", minReplacementSteps("e", target, replacements))
+	var trace *Trace
+	if *search != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		opts := []searchOption{withMaxStates(*maxStates), withRestarts(*restarts), withSeed(*seed)}
+		if *progress {
+			opts = append(opts, withProgress(func(p Progress) {
+				fmt.Fprintln(os.Stderr, p)
+			}, 100_000))
+		}
+		trace, err = grammar.Search(ctx, *search, "e", target, opts...)
+	} else {
+		trace, err = grammar.Derive("e", target)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Part 2: %d\n", len(trace.Steps))
+
+	switch *traceFmt {
+	case "":
+	case "text":
+		trace.WriteText(os.Stdout)
+	case "json":
+		if err := trace.WriteJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown trace format %q, want text or json", *traceFmt)
+	}
 }
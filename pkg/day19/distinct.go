@@ -0,0 +1,132 @@
+package main
+
+// editKey identifies the molecule one replacement makes without storing
+// it. Replacing element i of M with R gives S = M[:i] + R + M[i+1:]. If p
+// is the first place S and M differ and k = len(R)-1, then S is
+//
+//	M[:p] + rest + M[p+len(rest)-k:]
+//
+// for some tail rest of R. Taking the shortest rest that works makes the
+// key unique, so two replacements give the same molecule exactly when
+// their keys match.
+type editKey struct {
+	k    int
+	rest string
+}
+
+// distinctCounter counts distinct single replacement results by sweeping
+// the molecule left to right. Every result starting at i first differs at
+// some p >= i, so keys are grouped by p and a group can be counted and
+// dropped as soon as the sweep passes it.
+type distinctCounter struct {
+	mol []int
+	// byFrom lists the right sides of the reactions for each element
+	byFrom map[int][][]int
+	// runs[k][x] is how many elements from x on match the ones k further
+	// along, so extending a match past the replacement is O(1)
+	runs map[int][]int32
+
+	pending map[int]map[editKey]bool
+	count   int
+}
+
+// CountDistinct is how many different molecules a single reaction can turn
+// molecule into. It only keeps keys for replacements whose results might
+// still collide, rather than every resulting molecule.
+func (g *Grammar) CountDistinct(molecule string) (int, error) {
+	tokens, err := tokenize(molecule)
+	if err != nil {
+		return 0, err
+	}
+	// Elements no reaction mentions still need ids so they compare properly
+	ids := make(map[string]int)
+	id := func(token string) int {
+		if i, ok := g.index[token]; ok {
+			return i
+		}
+		if _, ok := ids[token]; !ok {
+			ids[token] = len(g.Symbols) + len(ids)
+		}
+		return ids[token]
+	}
+	mol := make([]int, len(tokens))
+	for i, token := range tokens {
+		mol[i] = id(token)
+	}
+
+	c := &distinctCounter{
+		mol:     mol,
+		byFrom:  make(map[int][][]int),
+		runs:    make(map[int][]int32),
+		pending: make(map[int]map[editKey]bool),
+	}
+	for _, rule := range g.Rules {
+		c.byFrom[rule.From] = append(c.byFrom[rule.From], rule.To)
+		if k := len(rule.To) - 1; k > 0 && c.runs[k] == nil {
+			c.runs[k] = shiftedRuns(mol, k)
+		}
+	}
+	return c.run(), nil
+}
+
+func shiftedRuns(mol []int, k int) []int32 {
+	runs := make([]int32, len(mol)+1)
+	for x := len(mol) - k - 1; x >= 0; x-- {
+		if mol[x] == mol[x+k] {
+			runs[x] = runs[x+1] + 1
+		}
+	}
+	return runs
+}
+
+func (c *distinctCounter) run() int {
+	for i, sym := range c.mol {
+		for _, to := range c.byFrom[sym] {
+			c.add(i, to)
+		}
+		c.flush(i)
+	}
+	for p := range c.pending {
+		c.flush(p)
+	}
+	return c.count
+}
+
+func (c *distinctCounter) flush(p int) {
+	c.count += len(c.pending[p])
+	delete(c.pending, p)
+}
+
+// add records replacing element i with to.
+func (c *distinctCounter) add(i int, to []int) {
+	n, k := len(c.mol), len(to)-1
+
+	// Find where the result first differs from the molecule
+	j := 0
+	for j < len(to) && i+j < n && to[j] == c.mol[i+j] {
+		j++
+	}
+	var p int
+	var rest []int
+	if j < len(to) {
+		p, rest = i+j, to[j:]
+	} else if k == 0 {
+		// Replacing an element with itself gives back the molecule
+		p = n
+	} else {
+		// The replacement matched, so the result carries on matching for
+		// as long as the molecule matches itself shifted by k
+		p = i + len(to) + int(c.runs[k][i+1])
+	}
+
+	// Trim the tail of rest that the shifted molecule supplies anyway
+	l := len(rest)
+	for l > 0 && p+l-1-k >= 0 && p+l-1-k < n && rest[l-1] == c.mol[p+l-1-k] {
+		l--
+	}
+
+	if c.pending[p] == nil {
+		c.pending[p] = make(map[editKey]bool)
+	}
+	c.pending[p][editKey{k, moleculeKey(rest[:l])}] = true
+}
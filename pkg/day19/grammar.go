@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode"
+)
+
+var (
+	ErrToken         = errors.New("invalid element")
+	ErrNotDerivable  = errors.New("target can't be derived")
+	ErrUnknownSymbol = errors.New("unknown element")
+)
+
+// tokenize splits a molecule into its elements. An element is an uppercase
+// letter followed by any lowercase letters, except for the electron e.
+func tokenize(molecule string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(molecule); {
+		r := rune(molecule[i])
+		switch {
+		case r == 'e':
+			tokens = append(tokens, "e")
+			i++
+		case unicode.IsUpper(r):
+			j := i + 1
+			for j < len(molecule) && unicode.IsLower(rune(molecule[j])) {
+				j++
+			}
+			tokens = append(tokens, molecule[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("%w %q at %d in %q", ErrToken, r, i, molecule)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty molecule", ErrToken)
+	}
+	return tokens, nil
+}
+
+// Rule is a reaction with its elements resolved to symbol indexes.
+type Rule struct {
+	From int
+	To   []int
+}
+
+// Grammar is the reactions read as a context free grammar over elements.
+// Every element is both a terminal and a nonterminal, since an element can
+// stay as it is or be replaced.
+type Grammar struct {
+	Symbols []string
+	Rules   []Rule
+	index   map[string]int
+}
+
+func NewGrammar(reactions []Reaction) (*Grammar, error) {
+	g := &Grammar{index: make(map[string]int)}
+	for _, reaction := range reactions {
+		from, err := tokenize(reaction.from)
+		if err != nil {
+			return nil, err
+		}
+		if len(from) != 1 {
+			return nil, fmt.Errorf("%w: %s => %s replaces more than one element", ErrToken, reaction.from, reaction.to)
+		}
+		to, err := tokenize(reaction.to)
+		if err != nil {
+			return nil, err
+		}
+		g.Rules = append(g.Rules, Rule{g.symbol(from[0]), g.symbols(to)})
+	}
+	return g, nil
+}
+
+func (g *Grammar) symbol(name string) int {
+	if i, ok := g.index[name]; ok {
+		return i
+	}
+	g.index[name] = len(g.Symbols)
+	g.Symbols = append(g.Symbols, name)
+	return len(g.Symbols) - 1
+}
+
+func (g *Grammar) symbols(names []string) []int {
+	var res []int
+	for _, name := range names {
+		res = append(res, g.symbol(name))
+	}
+	return res
+}
+
+// Parse tokenizes a molecule into symbols of the grammar.
+func (g *Grammar) Parse(molecule string) ([]int, error) {
+	tokens, err := tokenize(molecule)
+	if err != nil {
+		return nil, err
+	}
+	var res []int
+	for _, token := range tokens {
+		i, ok := g.index[token]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownSymbol, token)
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func (g *Grammar) Molecule(symbols []int) string {
+	res := ""
+	for _, s := range symbols {
+		res += g.Symbols[s]
+	}
+	return res
+}
+
+const inf = math.MaxInt32
+
+// binaryRule is A => B C. Long rules get split into a chain of these with
+// helper symbols, and only the first link costs a step. rule is the index
+// of the reaction it came from.
+type binaryRule struct {
+	from, left, right int
+	cost              int
+	rule              int
+}
+
+type unitRule struct {
+	from, to int
+	rule     int
+}
+
+// cnf is a grammar in the shape CYK wants: every rule has one or two
+// symbols on the right.
+type cnf struct {
+	numSymbols int
+	// byLeft indexes binary rules by the first symbol on their right side,
+	// and byFrom by their left side
+	byLeft [][]binaryRule
+	byFrom [][]binaryRule
+	units  []unitRule
+}
+
+func (g *Grammar) binarize() *cnf {
+	c := &cnf{numSymbols: len(g.Symbols)}
+	var binaries []binaryRule
+	for r, rule := range g.Rules {
+		if len(rule.To) == 1 {
+			c.units = append(c.units, unitRule{rule.From, rule.To[0], r})
+			continue
+		}
+		from, cost := rule.From, 1
+		for k := 0; k < len(rule.To)-2; k++ {
+			helper := c.numSymbols
+			c.numSymbols++
+			binaries = append(binaries, binaryRule{from, rule.To[k], helper, cost, r})
+			from, cost = helper, 0
+		}
+		binaries = append(binaries, binaryRule{from, rule.To[len(rule.To)-2], rule.To[len(rule.To)-1], cost, r})
+	}
+	c.byLeft = make([][]binaryRule, c.numSymbols)
+	c.byFrom = make([][]binaryRule, c.numSymbols)
+	for _, b := range binaries {
+		c.byLeft[b.left] = append(c.byLeft[b.left], b)
+		c.byFrom[b.from] = append(c.byFrom[b.from], b)
+	}
+	return c
+}
+
+// cell holds the fewest steps to derive a span of the target from each
+// symbol, along with the symbols that can derive it at all.
+type cell struct {
+	cost    []int
+	derives []int
+}
+
+func newCell(n int) *cell {
+	c := &cell{cost: make([]int, n)}
+	for i := range c.cost {
+		c.cost[i] = inf
+	}
+	return c
+}
+
+func (c *cell) relax(symbol, cost int) bool {
+	if cost >= c.cost[symbol] {
+		return false
+	}
+	if c.cost[symbol] == inf {
+		c.derives = append(c.derives, symbol)
+	}
+	c.cost[symbol] = cost
+	return true
+}
+
+// closeUnits applies single symbol rules until nothing improves.
+func (c *cell) closeUnits(units []unitRule) {
+	for changed := true; changed; {
+		changed = false
+		for _, u := range units {
+			if c.cost[u.to] != inf && c.relax(u.from, c.cost[u.to]+1) {
+				changed = true
+			}
+		}
+	}
+}
+
+// chart is a finished weighted CYK parse of a molecule.
+type chart struct {
+	g       *Grammar
+	c       *cnf
+	symbols []int
+	// cells[i][l-1] covers symbols[i:i+l]
+	cells [][]*cell
+}
+
+func (g *Grammar) parseChart(target string) (*chart, error) {
+	symbols, err := g.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotDerivable, err)
+	}
+
+	c := g.binarize()
+	n := len(symbols)
+	cells := make([][]*cell, n)
+	for i, s := range symbols {
+		cells[i] = make([]*cell, n-i)
+		cells[i][0] = newCell(c.numSymbols)
+		cells[i][0].relax(s, 0)
+		cells[i][0].closeUnits(c.units)
+	}
+	for l := 2; l <= n; l++ {
+		for i := 0; i+l <= n; i++ {
+			span := newCell(c.numSymbols)
+			for k := 1; k < l; k++ {
+				left, right := cells[i][k-1], cells[i+k][l-k-1]
+				for _, b := range left.derives {
+					for _, rule := range c.byLeft[b] {
+						if rc := right.cost[rule.right]; rc != inf {
+							span.relax(rule.from, left.cost[b]+rc+rule.cost)
+						}
+					}
+				}
+			}
+			span.closeUnits(c.units)
+			cells[i][l-1] = span
+		}
+	}
+	return &chart{g, c, symbols, cells}, nil
+}
+
+func (ch *chart) cost(i, l, symbol int) int {
+	return ch.cells[i][l-1].cost[symbol]
+}
+
+// MinSteps is the exact fewest reactions needed to turn start into target,
+// found with a weighted CYK parse of target. It returns ErrNotDerivable if
+// no sequence of reactions works.
+func (g *Grammar) MinSteps(start, target string) (int, error) {
+	t, err := g.Derive(start, target)
+	if err != nil {
+		return 0, err
+	}
+	return len(t.Steps), nil
+}
+
+// Derive is MinSteps, but returns the reactions as well as how many there
+// are.
+func (g *Grammar) Derive(start, target string) (*Trace, error) {
+	from, ok := g.index[start]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSymbol, start)
+	}
+	ch, err := g.parseChart(target)
+	if err != nil {
+		return nil, err
+	}
+	n := len(ch.symbols)
+	if ch.cost(0, n, from) == inf {
+		return nil, fmt.Errorf("%w from %s", ErrNotDerivable, start)
+	}
+	var apps []application
+	ch.walk(0, n, from, 0, &apps)
+	return g.trace(from, apps), nil
+}
+
+// walk works back from the chart to a leftmost derivation of symbols[i:i+l]
+// from symbol, which sits at element pos of the molecule being built. It
+// relies on every cost in the chart having come from some rule, so one of
+// them always adds up.
+func (ch *chart) walk(i, l, symbol, pos int, apps *[]application) {
+	want := ch.cost(i, l, symbol)
+	if l == 1 && want == 0 {
+		return
+	}
+	for _, u := range ch.c.units {
+		if u.from == symbol && ch.cost(i, l, u.to) != inf && ch.cost(i, l, u.to)+1 == want {
+			*apps = append(*apps, application{u.rule, pos})
+			ch.walk(i, l, u.to, pos, apps)
+			return
+		}
+	}
+	for k := 1; k < l; k++ {
+		for _, b := range ch.c.byFrom[symbol] {
+			lc, rc := ch.cost(i, k, b.left), ch.cost(i+k, l-k, b.right)
+			if lc == inf || rc == inf || lc+rc+b.cost != want {
+				continue
+			}
+			if b.cost == 1 {
+				*apps = append(*apps, application{b.rule, pos})
+			}
+			// Once the left side is fully expanded it covers exactly its
+			// k elements of the target, so the right side starts k along
+			ch.walk(i, k, b.left, pos, apps)
+			ch.walk(i+k, l-k, b.right, pos+k, apps)
+			return
+		}
+	}
+	panic(fmt.Sprintf("no derivation of %s over %d+%d", ch.g.Symbols[symbol], i, l))
+}
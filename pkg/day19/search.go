@@ -0,0 +1,424 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSearchLimit  = errors.New("search gave up")
+	ErrNoDerivation = errors.New("no derivation found")
+)
+
+// Progress is a snapshot of a running search.
+type Progress struct {
+	Strategy string
+	// Explored is how many molecules have been expanded so far
+	Explored int
+	Frontier int
+	// Shortest is the fewest elements in any molecule reached so far
+	Shortest int
+	Restarts int
+	Elapsed  time.Duration
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("%s: %d explored, %d queued, shortest %d, %d restarts, %s",
+		p.Strategy, p.Explored, p.Frontier, p.Shortest, p.Restarts, p.Elapsed.Round(time.Millisecond))
+}
+
+// searcher reduces target back to start by running reactions in reverse.
+type searcher struct {
+	g      *Grammar
+	start  int
+	target []int
+	// dead marks symbols no reaction produces, which can never be reduced
+	// away once they show up
+	dead []bool
+
+	maxStates     int
+	restarts      int
+	rng           *rand.Rand
+	progress      func(Progress)
+	progressEvery int
+
+	strategy string
+	began    time.Time
+	stats    Progress
+}
+
+type searchOption func(*searcher)
+
+// withMaxStates bounds how many molecules BFS and A* expand, and how many
+// reductions greedy makes per restart, before giving up.
+func withMaxStates(n int) searchOption {
+	return func(s *searcher) {
+		s.maxStates = n
+	}
+}
+
+func withRestarts(n int) searchOption {
+	return func(s *searcher) {
+		s.restarts = n
+	}
+}
+
+func withSeed(seed int64) searchOption {
+	return func(s *searcher) {
+		s.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// withProgress calls f after every n expanded molecules, and once more when
+// the search ends. n below 1 counts as 1.
+func withProgress(f func(Progress), n int) searchOption {
+	return func(s *searcher) {
+		s.progress = f
+		s.progressEvery = max(n, 1)
+	}
+}
+
+// strategy runs a search and returns the reactions it found, in the order
+// they build target from start.
+type strategy func(s *searcher, ctx context.Context) ([]application, error)
+
+var strategies = map[string]strategy{
+	"bfs":    (*searcher).bfs,
+	"astar":  (*searcher).aStar,
+	"greedy": (*searcher).greedy,
+}
+
+func strategyNames() string {
+	var names []string
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Search finds a way to build target from start by running reactions
+// backwards from target with the named strategy. bfs and astar return the
+// fewest steps; greedy returns whatever the first successful restart found.
+// The search stops early with ctx's error when ctx is done.
+func (g *Grammar) Search(ctx context.Context, name, start, target string, opts ...searchOption) (*Trace, error) {
+	run, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, want one of %s", name, strategyNames())
+	}
+	from, ok := g.index[start]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSymbol, start)
+	}
+	symbols, err := g.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotDerivable, err)
+	}
+
+	s := &searcher{
+		g:             g,
+		start:         from,
+		target:        symbols,
+		dead:          make([]bool, len(g.Symbols)),
+		maxStates:     1_000_000,
+		restarts:      100,
+		rng:           rand.New(rand.NewSource(1)),
+		progressEvery: 100_000,
+		strategy:      name,
+		began:         time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for i := range s.dead {
+		s.dead[i] = true
+	}
+	for _, rule := range g.Rules {
+		for _, sym := range rule.To {
+			s.dead[sym] = false
+		}
+	}
+	s.stats = Progress{Strategy: name, Shortest: len(symbols)}
+
+	apps, err := run(s, ctx)
+	s.report(true)
+	if err != nil {
+		return nil, err
+	}
+	return g.trace(from, apps), nil
+}
+
+func (s *searcher) report(final bool) {
+	if s.progress == nil || (!final && s.stats.Explored%s.progressEvery != 0) {
+		return
+	}
+	s.stats.Elapsed = time.Since(s.began)
+	s.progress(s.stats)
+}
+
+// expanded counts one more molecule and checks whether to stop.
+func (s *searcher) expanded(ctx context.Context, frontier int) error {
+	s.stats.Explored++
+	s.stats.Frontier = frontier
+	s.report(false)
+	if s.stats.Explored%1000 == 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s after %d molecules: %w", s.strategy, s.stats.Explored, err)
+		}
+	}
+	return nil
+}
+
+func (s *searcher) done(mol []int) bool {
+	return len(mol) == 1 && mol[0] == s.start
+}
+
+// viable reports whether mol could still reduce to start.
+func (s *searcher) viable(mol []int) bool {
+	if s.done(mol) {
+		return true
+	}
+	for _, sym := range mol {
+		if s.dead[sym] {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAt(mol []int, i int, to []int) bool {
+	if i+len(to) > len(mol) {
+		return false
+	}
+	for k, sym := range to {
+		if mol[i+k] != sym {
+			return false
+		}
+	}
+	return true
+}
+
+func reduce(mol []int, i int, rule Rule) []int {
+	res := make([]int, 0, len(mol)-len(rule.To)+1)
+	res = append(res, mol[:i]...)
+	res = append(res, rule.From)
+	return append(res, mol[i+len(rule.To):]...)
+}
+
+// reduction is a molecule one reverse reaction away from another, along
+// with the reaction that gets back.
+type reduction struct {
+	mol []int
+	app application
+}
+
+// reductions lists every viable molecule one reverse reaction away.
+func (s *searcher) reductions(mol []int) []reduction {
+	var res []reduction
+	for r, rule := range s.g.Rules {
+		for i := range mol {
+			if matchesAt(mol, i, rule.To) {
+				if next := reduce(mol, i, rule); s.viable(next) {
+					res = append(res, reduction{next, application{r, i}})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// link records how a search reached a molecule: the molecule it was
+// reduced from, by key, and the reaction that undoes the reduction.
+type link struct {
+	parent string
+	app    application
+}
+
+func visited(links map[string]link, key string) bool {
+	_, ok := links[key]
+	return ok
+}
+
+// path follows links from the molecule with key back to the target. The
+// last reduction found is the first reaction to apply, so no reversing is
+// needed.
+func path(links map[string]link, key, target string) []application {
+	var apps []application
+	for key != target {
+		l := links[key]
+		apps = append(apps, l.app)
+		key = l.parent
+	}
+	return apps
+}
+
+func moleculeKey(mol []int) string {
+	runes := make([]rune, len(mol))
+	for i, sym := range mol {
+		runes[i] = rune(sym)
+	}
+	return string(runes)
+}
+
+func (s *searcher) seen(mol []int) {
+	s.stats.Shortest = min(s.stats.Shortest, len(mol))
+}
+
+func (s *searcher) bfs(ctx context.Context) ([]application, error) {
+	root := moleculeKey(s.target)
+	links := map[string]link{root: {}}
+	level := [][]int{s.target}
+	for len(level) > 0 {
+		var next [][]int
+		for _, mol := range level {
+			if s.done(mol) {
+				return path(links, moleculeKey(mol), root), nil
+			}
+			if s.stats.Explored >= s.maxStates {
+				return nil, fmt.Errorf("%w: bfs expanded %d molecules", ErrSearchLimit, s.stats.Explored)
+			}
+			if err := s.expanded(ctx, len(level)+len(next)); err != nil {
+				return nil, err
+			}
+			parent := moleculeKey(mol)
+			for _, r := range s.reductions(mol) {
+				if key := moleculeKey(r.mol); !visited(links, key) {
+					links[key] = link{parent, r.app}
+					s.seen(r.mol)
+					next = append(next, r.mol)
+				}
+			}
+		}
+		level = next
+	}
+	return nil, fmt.Errorf("%w: bfs ran out of molecules", ErrNotDerivable)
+}
+
+type node struct {
+	mol   []int
+	steps int
+	// priority is steps plus the heuristic
+	priority int
+}
+
+type nodeQueue []node
+
+func (q nodeQueue) Len() int { return len(q) }
+func (q nodeQueue) Less(i, j int) bool {
+	if q[i].priority == q[j].priority {
+		return len(q[i].mol) < len(q[j].mol)
+	}
+	return q[i].priority < q[j].priority
+}
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(node)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// aStar uses the fewest reductions that could shrink a molecule to a single
+// element, given the most any one reaction removes, as its heuristic. That
+// never overestimates, so the first time start comes off the queue the
+// count is the minimum.
+func (s *searcher) aStar(ctx context.Context) ([]application, error) {
+	shrink := 1
+	for _, rule := range s.g.Rules {
+		shrink = max(shrink, len(rule.To)-1)
+	}
+	h := func(mol []int) int {
+		return (len(mol) - 1 + shrink - 1) / shrink
+	}
+
+	root := moleculeKey(s.target)
+	best := map[string]int{root: 0}
+	links := make(map[string]link)
+	q := &nodeQueue{{s.target, 0, h(s.target)}}
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(node)
+		parent := moleculeKey(cur.mol)
+		if cur.steps > best[parent] {
+			continue
+		}
+		if s.done(cur.mol) {
+			return path(links, parent, root), nil
+		}
+		if s.stats.Explored >= s.maxStates {
+			return nil, fmt.Errorf("%w: astar expanded %d molecules", ErrSearchLimit, s.stats.Explored)
+		}
+		if err := s.expanded(ctx, q.Len()); err != nil {
+			return nil, err
+		}
+		for _, r := range s.reductions(cur.mol) {
+			key := moleculeKey(r.mol)
+			if steps, ok := best[key]; ok && steps <= cur.steps+1 {
+				continue
+			}
+			best[key] = cur.steps + 1
+			links[key] = link{parent, r.app}
+			s.seen(r.mol)
+			heap.Push(q, node{r.mol, cur.steps + 1, cur.steps + 1 + h(r.mol)})
+		}
+	}
+	return nil, fmt.Errorf("%w: astar ran out of molecules", ErrNotDerivable)
+}
+
+// greedy shuffles the reactions, then keeps applying the first one that
+// fits, leftmost match first, until it reaches start or gets stuck. Getting
+// stuck starts over with a new order.
+func (s *searcher) greedy(ctx context.Context) ([]application, error) {
+	order := make([]int, len(s.g.Rules))
+	for i := range order {
+		order[i] = i
+	}
+	for restart := 0; restart <= s.restarts; restart++ {
+		s.stats.Restarts = restart
+		s.rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+
+		mol := s.target
+		var apps []application
+		for len(apps) < s.maxStates {
+			if s.done(mol) {
+				// apps are reductions from target, so the last is the
+				// first reaction to apply
+				for i, j := 0, len(apps)-1; i < j; i, j = i+1, j-1 {
+					apps[i], apps[j] = apps[j], apps[i]
+				}
+				return apps, nil
+			}
+			if err := s.expanded(ctx, 0); err != nil {
+				return nil, err
+			}
+			r, ok := s.firstReduction(mol, order)
+			if !ok {
+				break
+			}
+			mol = r.mol
+			apps = append(apps, r.app)
+			s.seen(mol)
+		}
+	}
+	return nil, fmt.Errorf("%w: greedy gave up after %d restarts", ErrNoDerivation, s.restarts)
+}
+
+func (s *searcher) firstReduction(mol []int, order []int) (reduction, bool) {
+	for _, r := range order {
+		rule := s.g.Rules[r]
+		for i := range mol {
+			if matchesAt(mol, i, rule.To) {
+				if next := reduce(mol, i, rule); s.viable(next) {
+					return reduction{next, application{r, i}}, true
+				}
+			}
+		}
+	}
+	return reduction{}, false
+}
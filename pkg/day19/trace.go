@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrBadTrace = errors.New("trace doesn't replay")
+
+// application is a reaction applied to the element at pos.
+type application struct {
+	rule int
+	pos  int
+}
+
+// Step is one reaction in a derivation. Position counts elements, not
+// bytes, and Molecule is the result of the step.
+type Step struct {
+	Position int    `json:"position"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Molecule string `json:"molecule"`
+}
+
+// Trace is a derivation of Target from Start, one reaction at a time.
+type Trace struct {
+	Start  string `json:"start"`
+	Target string `json:"target"`
+	Steps  []Step `json:"steps"`
+}
+
+// trace replays applications forwards from start to fill in each step.
+func (g *Grammar) trace(start int, apps []application) *Trace {
+	mol := []int{start}
+	t := &Trace{Start: g.Symbols[start]}
+	for _, app := range apps {
+		rule := g.Rules[app.rule]
+		mol = expand(mol, app.pos, rule)
+		t.Steps = append(t.Steps, Step{
+			Position: app.pos,
+			From:     g.Symbols[rule.From],
+			To:       g.Molecule(rule.To),
+			Molecule: g.Molecule(mol),
+		})
+	}
+	t.Target = g.Molecule(mol)
+	return t
+}
+
+// expand is reduce backwards: it replaces the element at i with the
+// rule's right side.
+func expand(mol []int, i int, rule Rule) []int {
+	res := make([]int, 0, len(mol)+len(rule.To)-1)
+	res = append(res, mol[:i]...)
+	res = append(res, rule.To...)
+	return append(res, mol[i+1:]...)
+}
+
+func (t *Trace) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%4d  %s\n", 0, t.Start)
+	for i, step := range t.Steps {
+		fmt.Fprintf(w, "%4d  %s => %s at %d: %s\n", i+1, step.From, step.To, step.Position, step.Molecule)
+	}
+}
+
+func (t *Trace) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+func ReadTrace(r io.Reader) (*Trace, error) {
+	var t Trace
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Verify replays t with the grammar's reactions and checks that every
+// step is a real reaction on the right element, that each recorded
+// molecule matches, and that it ends at target.
+func (g *Grammar) Verify(t *Trace, target string) error {
+	mol, err := g.Parse(t.Start)
+	if err != nil {
+		return fmt.Errorf("%w: start: %v", ErrBadTrace, err)
+	}
+	for i, step := range t.Steps {
+		rule, ok := g.findRule(step.From, step.To)
+		if !ok {
+			return fmt.Errorf("%w: step %d: no reaction %s => %s", ErrBadTrace, i+1, step.From, step.To)
+		}
+		if step.Position < 0 || step.Position >= len(mol) || mol[step.Position] != rule.From {
+			return fmt.Errorf("%w: step %d: no %s at %d in %s", ErrBadTrace, i+1, step.From, step.Position, g.Molecule(mol))
+		}
+		mol = expand(mol, step.Position, rule)
+		if got := g.Molecule(mol); got != step.Molecule {
+			return fmt.Errorf("%w: step %d: got %s, trace says %s", ErrBadTrace, i+1, got, step.Molecule)
+		}
+	}
+	if got := g.Molecule(mol); got != target {
+		return fmt.Errorf("%w: ends at %s instead of %s", ErrBadTrace, got, target)
+	}
+	if t.Target != target {
+		return fmt.Errorf("%w: trace is for %s instead of %s", ErrBadTrace, t.Target, target)
+	}
+	return nil
+}
+
+func (g *Grammar) findRule(from, to string) (Rule, bool) {
+	for _, rule := range g.Rules {
+		if g.Symbols[rule.From] == from && g.Molecule(rule.To) == to {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
+	"os"
 	"strconv"
 
+	"github.com/gorel/advent-2015/pkg/combat"
 	"golang.org/x/exp/constraints"
 )
 
@@ -33,93 +37,125 @@ func max[T constraints.Ordered](args ...T) T {
 	return m
 }
 
-type Item struct {
-	name  string
-	cost  int
-	dmg   int
-	armor int
+var weapons = []combat.Item{
+	{Name: "Dagger", Cost: 8, Damage: 4, Armor: 0},
+	{Name: "Shortsword", Cost: 10, Damage: 5, Armor: 0},
+	{Name: "Warhammer", Cost: 25, Damage: 6, Armor: 0},
+	{Name: "Longsword", Cost: 40, Damage: 7, Armor: 0},
+	{Name: "Greataxe", Cost: 74, Damage: 8, Armor: 0},
 }
 
-var weapons = []Item{
-	{"Dagger", 8, 4, 0},
-	{"Shortsword", 10, 5, 0},
-	{"Warhammer", 25, 6, 0},
-	{"Longsword", 40, 7, 0},
-	{"Greataxe", 74, 8, 0},
+var armors = []combat.Item{
+	{Name: "Leather", Cost: 13, Damage: 0, Armor: 1},
+	{Name: "Chainmail", Cost: 31, Damage: 0, Armor: 2},
+	{Name: "Splintmail", Cost: 53, Damage: 0, Armor: 3},
+	{Name: "Bandedmail", Cost: 75, Damage: 0, Armor: 4},
+	{Name: "Platemail", Cost: 102, Damage: 0, Armor: 5},
 }
 
-var armors = []Item{
-	{"Leather", 13, 0, 1},
-	{"Chainmail", 31, 0, 2},
-	{"Splintmail", 53, 0, 3},
-	{"Bandedmail", 75, 0, 4},
-	{"Platemail", 102, 0, 5},
-	{"(none)", 0, 0, 0},
+var rings = []combat.Item{
+	{Name: "Damage +1", Cost: 25, Damage: 1, Armor: 0},
+	{Name: "Damage +2", Cost: 50, Damage: 2, Armor: 0},
+	{Name: "Damage +3", Cost: 100, Damage: 3, Armor: 0},
+	{Name: "Defense +1", Cost: 20, Damage: 0, Armor: 1},
+	{Name: "Defense +2", Cost: 40, Damage: 0, Armor: 2},
+	{Name: "Defense +3", Cost: 80, Damage: 0, Armor: 3},
 }
 
-var rings = []Item{
-	{"Damage +1", 25, 1, 0},
-	{"Damage +2", 50, 2, 0},
-	{"Damage +3", 100, 3, 0},
-	{"Defense +1", 20, 0, 1},
-	{"Defense +2", 40, 0, 2},
-	{"Defense +3", 80, 0, 3},
-	{"(none-1)", 0, 0, 0},
-	{"(none-2)", 0, 0, 0},
-}
+const playerHP = 100
+
+var (
+	shopPath  = flag.String("shop", "", "shop catalog to load instead of the puzzle's shop")
+	slotRules = flag.String("slots", "weapons=1,armor=0-1,rings=0-2", "how many items each shop section takes, as name=count or name=min-max")
+	objective = flag.String("objective", "", "only run this objective: win (min cost to win), lose (max cost to lose) or margin (best win margin)")
+	verbose   = flag.Bool("v", false, "print the chosen loadouts")
+	report    = flag.Bool("report", false, "list every loadout with its cost and fight outcome")
+	sortKey   = flag.String("sort", "cost", "column to sort the report by: cost, rounds, hp, boss-hp, items or result")
+	desc      = flag.Bool("desc", false, "sort the report in descending order")
+	asCSV     = flag.Bool("csv", false, "write the report as CSV")
+)
 
-type Player struct {
-	hp    int
-	dmg   int
-	armor int
+func defaultShop() []Slot {
+	return []Slot{
+		{Name: "Weapons", Items: weapons},
+		{Name: "Armor", Items: armors},
+		{Name: "Rings", Items: rings},
+	}
 }
 
-func (p Player) winsAgainst(boss Player) bool {
-	for {
-		boss.hp -= max(1, p.dmg-boss.armor)
-		if boss.hp <= 0 {
-			return true
-		}
-		p.hp -= max(1, boss.dmg-p.armor)
-		if p.hp <= 0 {
-			return false
-		}
+func loadShop() ([]Slot, error) {
+	if *shopPath == "" {
+		return defaultShop(), nil
 	}
+	f, err := os.Open(*shopPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseShop(f)
 }
 
 func main() {
+	flag.Parse()
+
 	var hp, dmg, armor int
 	fmt.Scanf("Hit Points: %d\n", &hp)
 	fmt.Scanf("Damage: %d\n", &dmg)
 	fmt.Scanf("Armor: %d\n", &armor)
-	boss := Player{hp, dmg, armor}
-
-	minSpend := 1 << 31
-	maxSpend := -1 << 31
-	for _, weaponChoice := range weapons {
-		for _, armorChoice := range armors {
-			for _, leftRingChoice := range rings {
-				for _, rightRingChoice := range rings {
-					if leftRingChoice.name == rightRingChoice.name {
-						continue
-					}
-
-					spend := weaponChoice.cost + armorChoice.cost + leftRingChoice.cost + rightRingChoice.cost
-					dmg := weaponChoice.dmg + leftRingChoice.dmg + rightRingChoice.dmg
-					armor := armorChoice.armor + leftRingChoice.armor + rightRingChoice.armor
-					p := Player{100, dmg, armor}
-					if p.winsAgainst(boss) {
-						minSpend = min(minSpend, spend)
-					} else {
-						if spend > maxSpend {
-							maxSpend = spend
-						}
-					}
-				}
-			}
+	boss := combat.Entity{Name: "Boss", HP: hp, Damage: dmg, Armor: armor}
+	player := combat.Entity{Name: "Player", HP: playerHP}
+
+	shop, err := loadShop()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := applySlotRules(shop, *slotRules); err != nil {
+		log.Fatal(err)
+	}
+
+	if *report {
+		loadouts := allLoadouts(shop, player, boss)
+		if err := sortLoadouts(loadouts, *sortKey, *desc); err != nil {
+			log.Fatal(err)
+		}
+		write := writeReportTable
+		if *asCSV {
+			write = writeReportCSV
+		}
+		if err := write(os.Stdout, loadouts); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *objective != "" {
+		objectiveNames := map[string]Objective{
+			"win":    minCostToWin,
+			"lose":   maxCostToLose,
+			"margin": bestWinMargin,
 		}
+		o, ok := objectiveNames[*objective]
+		if !ok {
+			log.Fatalf("unknown objective %q", *objective)
+		}
+		best, nodes, ok := optimize(shop, player, boss, o)
+		if !ok {
+			fmt.Printf("%s: no loadout qualifies (%d nodes)\n", o.Name, nodes)
+			return
+		}
+		fmt.Printf("%s: %s, %dhp left (%d nodes)\n", o.Name, best, best.Outcome.HPLeft, nodes)
+		return
+	}
+
+	part1, nodes, _ := optimize(shop, player, boss, minCostToWin)
+	if *verbose {
+		fmt.Printf("%s: %s (%d nodes)\n", minCostToWin.Name, part1, nodes)
+	}
+	part2, nodes, _ := optimize(shop, player, boss, maxCostToLose)
+	if *verbose {
+		fmt.Printf("%s: %s (%d nodes)\n", maxCostToLose.Name, part2, nodes)
 	}
 
-	fmt.Printf("Part 1: %d\n", minSpend)
-	fmt.Printf("Part 2: %d\n", maxSpend)
+	fmt.Printf("Part 1: %d\n", part1.Cost)
+	fmt.Printf("Part 2: %d\n", part2.Cost)
 }
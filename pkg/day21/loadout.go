@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorel/advent-2015/pkg/combat"
+)
+
+// Slot is one section of the shop along with how many distinct items from
+// it a loadout has to have.
+type Slot struct {
+	Name  string
+	Items []combat.Item
+	Min   int
+	Max   int
+}
+
+// parseShop reads a shop in the same layout as the puzzle text:
+//
+//	Weapons:    Cost  Damage  Armor
+//	Dagger        8     4       0
+//
+// Sections are separated by blank lines and item names may contain spaces.
+// Stats can't be negative, which the search's bounds rely on.
+func parseShop(r io.Reader) ([]Slot, error) {
+	var shop []Slot
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if strings.HasSuffix(fields[0], ":") {
+			shop = append(shop, Slot{Name: strings.TrimSuffix(fields[0], ":")})
+			continue
+		}
+		if len(shop) == 0 {
+			return nil, fmt.Errorf("line %d: item before any section header", lineNum)
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: want name, cost, damage and armor", lineNum)
+		}
+		var stats [3]int
+		for i, field := range fields[len(fields)-3:] {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if n < 0 {
+				return nil, fmt.Errorf("line %d: negative %s %d", lineNum, [...]string{"cost", "damage", "armor"}[i], n)
+			}
+			stats[i] = n
+		}
+		slot := &shop[len(shop)-1]
+		slot.Items = append(slot.Items, combat.Item{
+			Name:   strings.Join(fields[:len(fields)-3], " "),
+			Cost:   stats[0],
+			Damage: stats[1],
+			Armor:  stats[2],
+		})
+	}
+	return shop, scanner.Err()
+}
+
+// applySlotRules sets how many items each slot takes from rules like
+// "weapons=1,armor=0-1,rings=0-2". Every slot in the shop needs a rule.
+func applySlotRules(shop []Slot, rules string) error {
+	seen := make(map[string]bool)
+	for _, rule := range strings.Split(rules, ",") {
+		name, count, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok {
+			return fmt.Errorf("bad slot rule %q, want name=count or name=min-max", rule)
+		}
+		lo, hi, isRange := strings.Cut(count, "-")
+		if !isRange {
+			hi = lo
+		}
+		minCount, err := strconv.Atoi(lo)
+		if err != nil {
+			return fmt.Errorf("bad slot rule %q: %w", rule, err)
+		}
+		maxCount, err := strconv.Atoi(hi)
+		if err != nil {
+			return fmt.Errorf("bad slot rule %q: %w", rule, err)
+		}
+		if minCount < 0 || maxCount < minCount {
+			return fmt.Errorf("bad slot rule %q: invalid range", rule)
+		}
+
+		found := false
+		for i := range shop {
+			if strings.EqualFold(shop[i].Name, name) {
+				shop[i].Min, shop[i].Max = minCount, maxCount
+				seen[shop[i].Name] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("slot rule for unknown slot %q", name)
+		}
+	}
+	for _, slot := range shop {
+		if !seen[slot.Name] {
+			return fmt.Errorf("no slot rule for %q", slot.Name)
+		}
+	}
+	return nil
+}
+
+// Loadout is a set of items bought from the shop and how the fight goes
+// when wearing them.
+type Loadout struct {
+	Items   []combat.Item
+	Cost    int
+	Outcome Outcome
+}
+
+func (l Loadout) String() string {
+	var names []string
+	for _, item := range l.Items {
+		names = append(names, item.Name)
+	}
+	return fmt.Sprintf("%s (cost %d)", strings.Join(names, ", "), l.Cost)
+}
+
+// Outcome is how a fight ends. HPLeft is the player's remaining HP.
+type Outcome struct {
+	Wins       bool
+	Rounds     int
+	HPLeft     int
+	BossHPLeft int
+}
+
+// bounds describe everything a search node can still turn into.
+type bounds struct {
+	minCost    int
+	maxCost    int
+	current    Outcome // fight with only the items picked so far
+	optimistic Outcome // fight with every remaining stat bonus we could pick
+}
+
+// Objective decides which loadout is best. Higher scores are better.
+type Objective struct {
+	Name string
+	// score rates a complete loadout, or returns false if it doesn't qualify.
+	score func(l Loadout) (int, bool)
+	// bound is the best score any completion of a node could get, or false
+	// if no completion can qualify. It has to be optimistic for the
+	// branch-and-bound to stay exact.
+	bound func(b bounds) (int, bool)
+}
+
+// Item stats are never negative, so more items can only help the player:
+// a node that loses with every remaining bonus can never win, and a node
+// that already wins can never lose.
+var (
+	minCostToWin = Objective{
+		Name: "min cost to win",
+		score: func(l Loadout) (int, bool) {
+			return -l.Cost, l.Outcome.Wins
+		},
+		bound: func(b bounds) (int, bool) {
+			return -b.minCost, b.optimistic.Wins
+		},
+	}
+
+	maxCostToLose = Objective{
+		Name: "max cost to lose",
+		score: func(l Loadout) (int, bool) {
+			return l.Cost, !l.Outcome.Wins
+		},
+		bound: func(b bounds) (int, bool) {
+			return b.maxCost, !b.current.Wins
+		},
+	}
+
+	// Ties on HP left go to the cheaper loadout
+	bestWinMargin = Objective{
+		Name: "best win margin",
+		score: func(l Loadout) (int, bool) {
+			return l.Outcome.HPLeft<<32 - l.Cost, l.Outcome.Wins
+		},
+		bound: func(b bounds) (int, bool) {
+			return b.optimistic.HPLeft<<32 - b.minCost, b.optimistic.Wins
+		},
+	}
+)
+
+type optimizer struct {
+	shop      []Slot
+	player    combat.Entity
+	boss      combat.Entity
+	objective Objective
+
+	chosen    []combat.Item
+	counts    []int
+	best      *Loadout
+	bestScore int
+	nodes     int
+}
+
+func fight(player combat.Entity, boss combat.Entity) Outcome {
+	res := combat.Duel(player, boss)
+	return Outcome{
+		Wins:       res.PlayerWins,
+		Rounds:     res.Rounds,
+		HPLeft:     max(0, res.PlayerHPLeft),
+		BossHPLeft: max(0, res.BossHPLeft),
+	}
+}
+
+// optimize finds the best loadout for the objective using branch-and-bound
+// over include/exclude decisions for every item. It returns false if no
+// loadout satisfies both the slot rules and the objective.
+func optimize(shop []Slot, player combat.Entity, boss combat.Entity, objective Objective) (Loadout, int, bool) {
+	// Cheap items first finds good loadouts early, which prunes more
+	sorted := make([]Slot, len(shop))
+	for i, slot := range shop {
+		slot.Items = append([]combat.Item(nil), slot.Items...)
+		sort.SliceStable(slot.Items, func(a, b int) bool {
+			return slot.Items[a].Cost < slot.Items[b].Cost
+		})
+		sorted[i] = slot
+	}
+	o := &optimizer{
+		shop:      sorted,
+		player:    player,
+		boss:      boss,
+		objective: objective,
+		counts:    make([]int, len(shop)),
+	}
+	o.search(0, 0)
+	if o.best == nil {
+		return Loadout{}, o.nodes, false
+	}
+	return *o.best, o.nodes, true
+}
+
+// sumBest adds up the n largest (or smallest) values, and reports whether
+// there were n to add up.
+func sumBest(values []int, n int, largest bool) (int, bool) {
+	if n <= 0 {
+		return 0, true
+	}
+	if len(values) < n {
+		return 0, false
+	}
+	sorted := append([]int(nil), values...)
+	if largest {
+		sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	} else {
+		sort.Ints(sorted)
+	}
+	total := 0
+	for _, v := range sorted[:n] {
+		total += v
+	}
+	return total, true
+}
+
+// bounds works out what the current node can still become, where slot s
+// has already decided on its items before index i. It returns false if
+// the slot rules can no longer be met.
+func (o *optimizer) bounds(s int, i int) (bounds, bool) {
+	current := o.player.Equip(o.chosen...)
+	b := bounds{minCost: combat.Cost(o.chosen...)}
+	b.maxCost = b.minCost
+	optimistic := current
+
+	for slot := s; slot < len(o.shop); slot++ {
+		remaining := o.shop[slot].Items
+		if slot == s {
+			remaining = remaining[i:]
+		}
+		var costs, damages, armors []int
+		for _, item := range remaining {
+			costs = append(costs, item.Cost)
+			damages = append(damages, item.Damage)
+			armors = append(armors, item.Armor)
+		}
+
+		need := o.shop[slot].Min - o.counts[slot]
+		room := min(o.shop[slot].Max-o.counts[slot], len(remaining))
+		minCost, ok := sumBest(costs, need, false)
+		if !ok {
+			return b, false
+		}
+		b.minCost += minCost
+		maxCost, _ := sumBest(costs, room, true)
+		b.maxCost += maxCost
+		dmg, _ := sumBest(damages, room, true)
+		optimistic.Damage += dmg
+		armor, _ := sumBest(armors, room, true)
+		optimistic.Armor += armor
+	}
+
+	b.current = fight(current, o.boss)
+	b.optimistic = fight(optimistic, o.boss)
+	return b, true
+}
+
+func (o *optimizer) search(s int, i int) {
+	o.nodes++
+	b, ok := o.bounds(s, i)
+	if !ok {
+		return
+	}
+	bound, ok := o.objective.bound(b)
+	if !ok || (o.best != nil && bound <= o.bestScore) {
+		return
+	}
+
+	if s == len(o.shop) {
+		l := Loadout{
+			Items:   append([]combat.Item(nil), o.chosen...),
+			Cost:    combat.Cost(o.chosen...),
+			Outcome: b.current,
+		}
+		if score, ok := o.objective.score(l); ok && (o.best == nil || score > o.bestScore) {
+			o.best = &l
+			o.bestScore = score
+		}
+		return
+	}
+	if i == len(o.shop[s].Items) {
+		o.search(s+1, 0)
+		return
+	}
+
+	// Take the item if the slot has room for it
+	if o.counts[s] < o.shop[s].Max {
+		o.chosen = append(o.chosen, o.shop[s].Items[i])
+		o.counts[s]++
+		o.search(s, i+1)
+		o.counts[s]--
+		o.chosen = o.chosen[:len(o.chosen)-1]
+	}
+	// Or leave it
+	o.search(s, i+1)
+}
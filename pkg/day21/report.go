@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gorel/advent-2015/pkg/combat"
+)
+
+// allLoadouts lists every loadout the slot rules allow, with the outcome of
+// the fight against boss.
+func allLoadouts(shop []Slot, player combat.Entity, boss combat.Entity) []Loadout {
+	var res []Loadout
+	var chosen []combat.Item
+
+	// Slot s has picked count items so far, and can pick items from i on
+	var walk func(s int, i int, count int)
+	walk = func(s int, i int, count int) {
+		if s == len(shop) {
+			res = append(res, Loadout{
+				Items:   append([]combat.Item(nil), chosen...),
+				Cost:    combat.Cost(chosen...),
+				Outcome: fight(player.Equip(chosen...), boss),
+			})
+			return
+		}
+		slot := shop[s]
+		if count >= slot.Min {
+			walk(s+1, 0, 0)
+		}
+		if count == slot.Max {
+			return
+		}
+		for j := i; j < len(slot.Items); j++ {
+			chosen = append(chosen, slot.Items[j])
+			walk(s, j+1, count+1)
+			chosen = chosen[:len(chosen)-1]
+		}
+	}
+	walk(0, 0, 0)
+	return res
+}
+
+func (l Loadout) itemNames() string {
+	var names []string
+	for _, item := range l.Items {
+		names = append(names, item.Name)
+	}
+	return strings.Join(names, " + ")
+}
+
+func (o Outcome) result() string {
+	if o.Wins {
+		return "win"
+	}
+	return "lose"
+}
+
+var reportSortKeys = map[string]func(a, b Loadout) bool{
+	"cost":    func(a, b Loadout) bool { return a.Cost < b.Cost },
+	"rounds":  func(a, b Loadout) bool { return a.Outcome.Rounds < b.Outcome.Rounds },
+	"hp":      func(a, b Loadout) bool { return a.Outcome.HPLeft < b.Outcome.HPLeft },
+	"boss-hp": func(a, b Loadout) bool { return a.Outcome.BossHPLeft < b.Outcome.BossHPLeft },
+	"items":   func(a, b Loadout) bool { return a.itemNames() < b.itemNames() },
+	"result":  func(a, b Loadout) bool { return !a.Outcome.Wins && b.Outcome.Wins },
+}
+
+func sortLoadouts(loadouts []Loadout, key string, desc bool) error {
+	less, ok := reportSortKeys[key]
+	if !ok {
+		var keys []string
+		for k := range reportSortKeys {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown sort key %q, want one of %s", key, strings.Join(keys, ", "))
+	}
+	sort.SliceStable(loadouts, func(i, j int) bool {
+		if desc {
+			return less(loadouts[j], loadouts[i])
+		}
+		return less(loadouts[i], loadouts[j])
+	})
+	return nil
+}
+
+var reportHeader = []string{"items", "cost", "result", "rounds", "hp left", "boss hp left"}
+
+func (l Loadout) reportRow() []string {
+	return []string{
+		l.itemNames(),
+		strconv.Itoa(l.Cost),
+		l.Outcome.result(),
+		strconv.Itoa(l.Outcome.Rounds),
+		strconv.Itoa(l.Outcome.HPLeft),
+		strconv.Itoa(l.Outcome.BossHPLeft),
+	}
+}
+
+func writeReportCSV(w io.Writer, loadouts []Loadout) error {
+	out := csv.NewWriter(w)
+	out.Write(reportHeader)
+	for _, l := range loadouts {
+		out.Write(l.reportRow())
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeReportTable(w io.Writer, loadouts []Loadout) error {
+	out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, strings.Join(reportHeader, "\t"))
+	for _, l := range loadouts {
+		fmt.Fprintln(out, strings.Join(l.reportRow(), "\t"))
+	}
+	return out.Flush()
+}
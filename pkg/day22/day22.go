@@ -2,118 +2,119 @@ package main
 
 import (
 	"container/heap"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
 
+	"github.com/gorel/advent-2015/pkg/combat"
 	"golang.org/x/exp/constraints"
 )
 
 // Pretty close to infinity
 const INF = 1 << 30
 
+var (
+	play    = flag.Bool("play", false, "play the fight interactively instead of solving it")
+	hard    = flag.Bool("hard", false, "use hard mode rules with -play")
+	drain   = flag.Int("mana-drain", 0, "mana lost at the start of each player turn with -play")
+	enrage  = flag.Int("enrage-round", 0, "round the boss enrages on with -play (0 to disable)")
+	rage    = flag.Int("enrage-dmg", 2, "extra boss damage once enraged")
+	bossHP  = flag.Int("boss-hp", 0, "boss hit points (read from stdin if unset)")
+	bossDmg = flag.Int("boss-dmg", 0, "boss damage (read from stdin if unset)")
+	export  = flag.String("export", "", "directory to write part1.jsonl and part2.jsonl replay logs to")
+	replay  = flag.String("replay", "", "replay log to re-simulate and check against the current rules")
+)
+
 var bestSeen = INF
 
 // Lazy copy-paste functions
-func max[T constraints.Ordered](args ...T) T {
+func min[T constraints.Ordered](args ...T) T {
 	m := args[0]
 	for _, arg := range args {
-		if arg > m {
+		if arg < m {
 			m = arg
 		}
 	}
 	return m
 }
 
-type Effect struct {
-	name           string
-	armor          int
-	playerPoison   int
-	poison         int
-	manaRecharge   int
-	turnsRemaining int
-}
-
-type Spell struct {
-	name    string
-	mana    int
-	damage  int
-	healing int
-	effect  *Effect
+func max[T constraints.Ordered](args ...T) T {
+	m := args[0]
+	for _, arg := range args {
+		if arg > m {
+			m = arg
+		}
+	}
+	return m
 }
 
-var spells = []Spell{
+var spells = []combat.Spell{
 	{
-		name:   "MagicMissile",
-		mana:   53,
-		damage: 4,
+		Name:   "MagicMissile",
+		Mana:   53,
+		Damage: 4,
 	},
 	{
-		name:    "Drain",
-		mana:    73,
-		damage:  2,
-		healing: 2,
+		Name:    "Drain",
+		Mana:    73,
+		Damage:  2,
+		Healing: 2,
 	},
 	{
-		name: "Shield",
-		mana: 113,
-		effect: &Effect{
-			name:           "Shield",
-			armor:          7,
-			turnsRemaining: 6,
+		Name: "Shield",
+		Mana: 113,
+		Effect: &combat.Effect{
+			Name:  "Shield",
+			Armor: 7,
+			Turns: 6,
 		},
 	},
 	{
-		name: "Poison",
-		mana: 173,
-		effect: &Effect{
-			name:           "Poison",
-			poison:         3,
-			turnsRemaining: 6,
+		Name: "Poison",
+		Mana: 173,
+		Effect: &combat.Effect{
+			Name:   "Poison",
+			Damage: 3,
+			Turns:  6,
 		},
 	},
 	{
-		name: "Recharge",
-		mana: 229,
-		effect: &Effect{
-			name:           "Recharge",
-			manaRecharge:   101,
-			turnsRemaining: 5,
+		Name: "Recharge",
+		Mana: 229,
+		Effect: &combat.Effect{
+			Name:         "Recharge",
+			ManaRecharge: 101,
+			Turns:        5,
 		},
 	},
 }
 
-type Player struct {
-	hp     int
-	mana   int
-	damage int
-	armor  int
-}
-
 type GameState struct {
-	turn    int
-	player  Player
-	boss    Player
-	effects map[string]Effect
+	combat.Arena
+	turn      int
+	modifiers []Modifier
 
 	cost   int
 	action string
+	spell  string
 	prev   *GameState
 	next   *GameState
 }
 
 type gameOption func(*GameState)
 
-func withEffect(e Effect) gameOption {
+func withEffect(e combat.Effect) gameOption {
 	return func(g *GameState) {
-		g.effects[e.name] = e
+		g.Effects[e.Name] = e
 	}
 }
 
-func NewGame(player Player, boss Player, opts ...gameOption) *GameState {
+func NewGame(player combat.Entity, boss combat.Entity, opts ...gameOption) *GameState {
 	res := &GameState{
-		player:  player,
-		boss:    boss,
-		effects: make(map[string]Effect),
-		action:  "START",
+		Arena:  combat.NewArena(player, boss),
+		action: "START",
 	}
 	for _, opt := range opts {
 		opt(res)
@@ -122,16 +123,10 @@ func NewGame(player Player, boss Player, opts ...gameOption) *GameState {
 }
 
 func (g *GameState) CloneAndAdvance() *GameState {
-	effects := make(map[string]Effect)
-	for key, e := range g.effects {
-		effects[key] = e
-	}
-
 	return &GameState{
-		turn:    g.turn + 1,
-		player:  g.player,
-		boss:    g.boss,
-		effects: effects,
+		Arena:     g.Arena.Clone(),
+		turn:      g.turn + 1,
+		modifiers: g.modifiers,
 
 		cost: g.cost,
 		prev: g,
@@ -176,59 +171,55 @@ func (c *CandidatesList) Pop() any {
 
 func (g *GameState) tickEffects(isPlayerTurn bool) *GameState {
 	nextState := g.CloneAndAdvance()
-	nextState.player.armor = 0
 
-	newEffects := make(map[string]Effect)
+	var notes string
+	if isPlayerTurn {
+		notes = nextState.runHooks(func(m Modifier) hook { return m.beforePlayerTurn })
+	} else {
+		notes = nextState.runHooks(func(m Modifier) hook { return m.beforeBossTurn })
+	}
+	if nextState.terminal() {
+		nextState.action = notes
+		return nextState
+	}
+
 	var action string
-	for _, e := range g.effects {
-		if isPlayerTurn {
-			nextState.player.hp -= e.playerPoison
-		}
-		nextState.player.armor = max(nextState.player.armor, e.armor)
-		nextState.boss.hp -= e.poison
-		nextState.player.mana += e.manaRecharge
-		e.turnsRemaining -= 1
+	for _, e := range nextState.TickEffects() {
 		turnsString := " (expiring)"
-		if e.turnsRemaining > 0 {
-			if e.turnsRemaining < INF/2 {
-				turnsString = fmt.Sprintf(" (%d turns left)", e.turnsRemaining)
-			} else {
-				turnsString = ""
-			}
-			newEffects[e.name] = e
+		if e.Turns > 0 {
+			turnsString = fmt.Sprintf(" (%d turns left)", e.Turns)
 		}
-		action += fmt.Sprintf(" {%s%s} ", e.name, turnsString)
+		action += fmt.Sprintf(" {%s%s} ", e.Name, turnsString)
 	}
 	if action != "" {
-		nextState.action = fmt.Sprintf("[tick effects: %s]", action)
+		action = fmt.Sprintf("[tick effects: %s]", action)
 	}
-	nextState.effects = newEffects
+	nextState.action = joinActions(notes, action)
 	return nextState
 }
 
-func (g *GameState) tickPlayerTurn(spell Spell) *GameState {
+func (g *GameState) tickPlayerTurn(spell combat.Spell) *GameState {
 	nextState := g.CloneAndAdvance()
-	nextState.action = fmt.Sprintf("Player casts %s (-%d mana)", spell.name, spell.mana)
-	nextState.cost += spell.mana
-	nextState.player.mana -= spell.mana
-	nextState.boss.hp -= spell.damage
-	nextState.player.hp += spell.healing
-	if spell.effect != nil {
-		nextState.effects[spell.effect.name] = *spell.effect
-	}
+	nextState.action = fmt.Sprintf("Player casts %s (-%d mana)", spell.Name, spell.Mana)
+	nextState.spell = spell.Name
+	nextState.cost += spell.Mana
+	nextState.Cast(spell)
+	notes := nextState.runHooks(func(m Modifier) hook { return m.afterPlayerTurn })
+	nextState.action = joinActions(nextState.action, notes)
 	return nextState
 }
 
 func (g *GameState) tickBossTurn() *GameState {
 	nextState := g.CloneAndAdvance()
-	dmg := max(1, g.boss.damage-g.player.armor)
+	dmg := nextState.Boss.Attack(&nextState.Player)
 	nextState.action = fmt.Sprintf("[boss hits for %d]", dmg)
-	nextState.player.hp -= dmg
+	notes := nextState.runHooks(func(m Modifier) hook { return m.afterBossTurn })
+	nextState.action = joinActions(nextState.action, notes)
 	return nextState
 }
 
 func (g *GameState) terminal() bool {
-	return g.player.hp <= 0 || g.boss.hp <= 0
+	return g.Over()
 }
 
 func (g *GameState) Play() *GameState {
@@ -236,10 +227,10 @@ func (g *GameState) Play() *GameState {
 	candidates.Add(g)
 	for !candidates.Empty() {
 		cur := heap.Pop(&candidates).(*GameState)
-		if cur.player.hp <= 0 {
+		if cur.Player.Dead() {
 			// Can't win from here
 			continue
-		} else if cur.boss.hp <= 0 {
+		} else if cur.Boss.Dead() {
 			// Found the cheapest win
 			return cur.unwind()
 		}
@@ -267,50 +258,55 @@ func (g *GameState) unwind() *GameState {
 func (g GameState) nextCandidates() []*GameState {
 	var res []*GameState
 	for _, spell := range spells {
-		// Environment effects before *player*
-		nextState := g.tickEffects(true)
-		if nextState.terminal() {
-			if nextState.boss.hp <= 0 {
-				res = append(res, nextState)
-			}
+		nextState, err := g.playRound(spell)
+		if err != nil {
 			continue
 		}
-
-		// Try to take the player's turn
-		// Not enough mana to cast
-		if g.player.mana < spell.mana {
-			continue
-		}
-		// Effect already active
-		if _, ok := nextState.effects[spell.name]; ok {
+		// Can't win from here
+		if nextState.Player.Dead() {
 			continue
 		}
+		res = append(res, nextState)
+	}
+	return res
+}
 
-		// Found a viable candidate
-		nextState = nextState.tickPlayerTurn(spell)
-		if nextState.terminal() {
-			if nextState.boss.hp <= 0 {
-				res = append(res, nextState)
-			}
-			continue
-		}
+// playRound plays one full round (player turn and boss turn) casting the
+// given spell. It stops early and returns the terminal state if the fight
+// ends partway through the round.
+func (g *GameState) playRound(spell combat.Spell) (*GameState, error) {
+	// Environment effects before *player*
+	nextState := g.tickEffects(true)
+	if nextState.terminal() {
+		return nextState, nil
+	}
 
-		// Apply effects before boss turn
-		nextState = nextState.tickEffects(false)
-		if nextState.terminal() {
-			if nextState.boss.hp <= 0 {
-				res = append(res, nextState)
-			}
-			continue
-		}
+	// Try to take the player's turn
+	if mana := min(g.Player.Mana, nextState.Player.Mana); mana < spell.Mana {
+		return nil, fmt.Errorf("not enough mana to cast %s (have %d, need %d)", spell.Name, mana, spell.Mana)
+	}
+	if err := nextState.CanCast(spell); err != nil {
+		return nil, err
+	}
 
-		// Let boss attack
-		nextState = nextState.tickBossTurn()
+	nextState = nextState.tickPlayerTurn(spell)
+	if nextState.terminal() {
+		return nextState, nil
+	}
 
-		// And no matter what, we push this as a new possible state
-		res = append(res, nextState)
+	// Apply effects before boss turn
+	nextState = nextState.tickEffects(false)
+	if nextState.terminal() {
+		return nextState, nil
 	}
-	return res
+
+	// Let boss attack
+	return nextState.tickBossTurn(), nil
+}
+
+// round is the 1-indexed round this state belongs to.
+func (g GameState) round() int {
+	return (g.turn-1)/4 + 1
 }
 
 func (g GameState) turnString() string {
@@ -331,56 +327,122 @@ func (g GameState) turnString() string {
 	return "INVALID STATE"
 }
 
-func (g GameState) PrintLog() {
-	colors := []string{
-		"\033[31m", // boss (red)
-		"\033[36m", // environment (light blue)
-		"\033[32m", // player (green)
-		"\033[36m", // environment (light blue)
+var turnColors = []string{
+	"\033[31m", // boss (red)
+	"\033[36m", // environment (light blue)
+	"\033[32m", // player (green)
+	"\033[36m", // environment (light blue)
+}
+
+const resetColor = "\033[0m"
+
+func (g GameState) logEntry() string {
+	turn := ""
+	turn += fmt.Sprintf("Turn %d (%s)\n", g.round(), g.turnString())
+	turn += "-------\n"
+	turn += fmt.Sprintf("%s\n", g.action)
+	turn += fmt.Sprintf("Player: %dhp, %dmana", g.Player.HP, g.Player.Mana)
+	if g.Player.BonusArmor > 0 {
+		turn += " (+armor)"
 	}
-	reset := "\033[0m"
+	turn += fmt.Sprintf("\nBoss: %dhp\n\n", g.Boss.HP)
+	return fmt.Sprintf("%s%s%s", turnColors[g.turn%len(turnColors)], turn, resetColor)
+}
+
+func (g GameState) PrintLog() {
 	cur := &g
 	for cur != nil {
 		if cur.action != "" {
-			turn := ""
-			turn += fmt.Sprintf("Turn %d (%s)\n", (cur.turn-1)/4+1, cur.turnString())
-			turn += "-------\n"
-			turn += fmt.Sprintf("%s\n", cur.action)
-			turn += fmt.Sprintf("Player: %dhp, %dmana", cur.player.hp, cur.player.mana)
-			if cur.player.armor > 0 {
-				turn += " (+armor)"
-			}
-			turn += fmt.Sprintf("\nBoss: %dhp\n\n", cur.boss.hp)
-			fmt.Printf("%s%s%s", colors[cur.turn%len(colors)], turn, reset)
+			fmt.Print(cur.logEntry())
 		}
 		cur = cur.next
 	}
 }
 
+func writeLog(g *GameState, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := g.WriteLog(f); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func replayLog(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	end, err := Replay(f)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	outcome := "unfinished"
+	if end.Boss.Dead() && !end.Player.Dead() {
+		outcome = "player wins"
+	} else if end.terminal() {
+		outcome = "boss wins"
+	}
+	fmt.Printf("%s: consistent over %d turns, %s, %d mana spent\n", path, end.round(), outcome, end.cost)
+}
+
 func main() {
-	var hp, dmg int
-	fmt.Scanf("Hit Points: %d\n", &hp)
-	fmt.Scanf("Damage: %d\n", &dmg)
-	player := Player{
-		hp:   50,
-		mana: 500,
+	flag.Parse()
+
+	if *replay != "" {
+		replayLog(*replay)
+		return
+	}
+
+	hp, dmg := *bossHP, *bossDmg
+	if hp == 0 {
+		fmt.Scanf("Hit Points: %d\n", &hp)
+	}
+	if dmg == 0 {
+		fmt.Scanf("Damage: %d\n", &dmg)
 	}
-	boss := Player{
-		hp:     hp,
-		damage: dmg,
+	player := combat.Entity{
+		Name: "Player",
+		HP:   50,
+		Mana: 500,
+	}
+	boss := combat.Entity{
+		Name:   "Boss",
+		HP:     hp,
+		Damage: dmg,
+	}
+
+	if *play {
+		var modifiers []Modifier
+		if *hard {
+			modifiers = append(modifiers, hardMode())
+		}
+		if *drain > 0 {
+			modifiers = append(modifiers, manaDrain(*drain))
+		}
+		if *enrage > 0 {
+			modifiers = append(modifiers, bossEnrage(*enrage, *rage))
+		}
+		NewSession(NewGame(player, boss, withModifiers(modifiers...)), os.Stdin, os.Stdout).Run()
+		return
 	}
 
 	game := NewGame(player, boss)
 	solution := game.Play()
 	solution.PrintLog()
+	if *export != "" {
+		writeLog(solution, filepath.Join(*export, "part1.jsonl"))
+	}
 	fmt.Printf("Part 1: %d\n", solution.cost)
 
-	hardMode := NewGame(player, boss, withEffect(Effect{
-		name:           "HardMode",
-		playerPoison:   1,
-		turnsRemaining: INF,
-	}))
-	solution = hardMode.Play()
+	hardGame := NewGame(player, boss, withModifiers(hardMode()))
+	solution = hardGame.Play()
 	solution.PrintLog()
+	if *export != "" {
+		writeLog(solution, filepath.Join(*export, "part2.jsonl"))
+	}
 	fmt.Printf("Part 2: %d\n", solution.cost)
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A hook runs against the state being built for the current phase and
+// returns a short note for the log, or "" if it didn't do anything.
+type hook func(g *GameState) string
+
+// Modifier changes the rules of the fight. Each hook is optional and fires
+// at a fixed point in the round:
+//
+//	beforePlayerTurn: start of the player's turn, before effects tick
+//	afterPlayerTurn:  right after the player casts
+//	beforeBossTurn:   start of the boss's turn, before effects tick
+//	afterBossTurn:    right after the boss attacks
+//
+// Modifiers run in the order they were added to the game.
+type Modifier struct {
+	name             string
+	args             []int
+	beforePlayerTurn hook
+	afterPlayerTurn  hook
+	beforeBossTurn   hook
+	afterBossTurn    hook
+}
+
+func withModifiers(m ...Modifier) gameOption {
+	return func(g *GameState) {
+		g.modifiers = append(g.modifiers, m...)
+	}
+}
+
+// hardMode is part 2: the player loses 1hp at the start of each of their turns.
+func hardMode() Modifier {
+	return Modifier{
+		name: "HardMode",
+		beforePlayerTurn: func(g *GameState) string {
+			g.Player.HP -= 1
+			return "-1hp"
+		},
+	}
+}
+
+// bossEnrage adds bonus damage to every boss attack from the given round on.
+func bossEnrage(round int, bonus int) Modifier {
+	return Modifier{
+		name: "BossEnrage",
+		args: []int{round, bonus},
+		beforeBossTurn: func(g *GameState) string {
+			if g.round() != round {
+				return ""
+			}
+			g.Boss.Damage += bonus
+			return fmt.Sprintf("boss enrages (+%d damage)", bonus)
+		},
+	}
+}
+
+// manaDrain takes mana from the player at the start of each of their turns.
+func manaDrain(amount int) Modifier {
+	return Modifier{
+		name: "ManaDrain",
+		args: []int{amount},
+		beforePlayerTurn: func(g *GameState) string {
+			drained := min(amount, g.Player.Mana)
+			if drained <= 0 {
+				return ""
+			}
+			g.Player.Mana -= drained
+			return fmt.Sprintf("-%d mana", drained)
+		},
+	}
+}
+
+// modifierFromSpec rebuilds a modifier from its name and arguments.
+func modifierFromSpec(name string, args []int) (Modifier, error) {
+	arity := map[string]int{
+		"HardMode":   0,
+		"BossEnrage": 2,
+		"ManaDrain":  1,
+	}
+	want, ok := arity[name]
+	if !ok {
+		return Modifier{}, fmt.Errorf("unknown modifier %q", name)
+	}
+	if len(args) != want {
+		return Modifier{}, fmt.Errorf("modifier %s takes %d arguments, got %d", name, want, len(args))
+	}
+	switch name {
+	case "BossEnrage":
+		return bossEnrage(args[0], args[1]), nil
+	case "ManaDrain":
+		return manaDrain(args[0]), nil
+	default:
+		return hardMode(), nil
+	}
+}
+
+func (g *GameState) runHooks(pick func(Modifier) hook) string {
+	var notes []string
+	for _, m := range g.modifiers {
+		h := pick(m)
+		if h == nil {
+			continue
+		}
+		if note := h(g); note != "" {
+			notes = append(notes, fmt.Sprintf("[%s: %s]", m.name, note))
+		}
+	}
+	return strings.Join(notes, " ")
+}
+
+func (g *GameState) modifierNames() []string {
+	var names []string
+	for _, m := range g.modifiers {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+func joinActions(actions ...string) string {
+	var res []string
+	for _, a := range actions {
+		if a != "" {
+			res = append(res, a)
+		}
+	}
+	return strings.Join(res, " ")
+}
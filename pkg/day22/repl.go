@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorel/advent-2015/pkg/combat"
+)
+
+// Session is an interactive fight where a human picks the spells.
+// Every entry in history is the state at the start of a player turn, so
+// undoing a move is just popping the last entry.
+type Session struct {
+	history []*GameState
+	in      *bufio.Scanner
+	out     io.Writer
+}
+
+func NewSession(game *GameState, in io.Reader, out io.Writer) *Session {
+	return &Session{
+		history: []*GameState{game},
+		in:      bufio.NewScanner(in),
+		out:     out,
+	}
+}
+
+func (s *Session) current() *GameState {
+	return s.history[len(s.history)-1]
+}
+
+func findSpell(name string) (combat.Spell, bool) {
+	if i, err := strconv.Atoi(name); err == nil && i >= 1 && i <= len(spells) {
+		return spells[i-1], true
+	}
+	for _, spell := range spells {
+		if strings.EqualFold(spell.Name, name) {
+			return spell, true
+		}
+	}
+	return combat.Spell{}, false
+}
+
+// detach copies the state into a fresh root so the solver can search from
+// it without unwind() rewriting the costs of our history.
+func (g *GameState) detach() *GameState {
+	res := g.CloneAndAdvance()
+	res.turn = g.turn
+	res.cost = 0
+	res.prev = nil
+	res.action = "START"
+	return res
+}
+
+// hint returns the first spell of the cheapest win from here and its cost.
+func (g *GameState) hint() (string, int, bool) {
+	solution := g.detach().Play()
+	if solution == nil {
+		return "", 0, false
+	}
+	for cur := solution; cur != nil; cur = cur.next {
+		if cur.spell != "" {
+			return cur.spell, solution.cost, true
+		}
+	}
+	// The effects already in play finish the boss off
+	return "", solution.cost, true
+}
+
+func (s *Session) printHelp() {
+	fmt.Fprintln(s.out, "Commands:")
+	for i, spell := range spells {
+		fmt.Fprintf(s.out, "  %d, %-13s cast %s (%d mana)\n", i+1, strings.ToLower(spell.Name), spell.Name, spell.Mana)
+	}
+	fmt.Fprintln(s.out, "  undo            take back the last round")
+	fmt.Fprintln(s.out, "  hint            ask the solver for the cheapest win from here")
+	fmt.Fprintln(s.out, "  log             replay the fight so far")
+	fmt.Fprintln(s.out, "  help            show this message")
+	fmt.Fprintln(s.out, "  quit            leave the game")
+}
+
+func (s *Session) printStatus() {
+	g := s.current()
+	fmt.Fprintf(s.out, "Round %d: player %dhp %dmana, boss %dhp, spent %d mana\n", len(s.history), g.Player.HP, g.Player.Mana, g.Boss.HP, g.cost)
+	if len(g.modifiers) > 0 {
+		fmt.Fprintf(s.out, "Modifiers: %s\n", strings.Join(g.modifierNames(), ", "))
+	}
+	if len(g.Effects) > 0 {
+		var active []string
+		for _, e := range g.Effects {
+			active = append(active, fmt.Sprintf("%s (%d)", e.Name, e.Turns))
+		}
+		sort.Strings(active)
+		fmt.Fprintf(s.out, "Active effects: %s\n", strings.Join(active, ", "))
+	}
+	switch {
+	case g.Boss.Dead():
+		fmt.Fprintf(s.out, "You win! Total mana spent: %d\n", g.cost)
+	case g.Player.Dead():
+		fmt.Fprintln(s.out, "You lose. Type 'undo' to try again.")
+	}
+}
+
+// printStates prints every state after from, up to and including to.
+func (s *Session) printStates(from, to *GameState) {
+	var round []*GameState
+	for cur := to; cur != nil && cur != from; cur = cur.prev {
+		round = append(round, cur)
+	}
+	for i := len(round) - 1; i >= 0; i-- {
+		if round[i].action != "" {
+			fmt.Fprint(s.out, round[i].logEntry())
+		}
+	}
+}
+
+func (s *Session) handle(cmd string) bool {
+	switch cmd {
+	case "":
+		return true
+	case "quit", "exit", "q":
+		return false
+	case "help", "?":
+		s.printHelp()
+	case "log":
+		s.printStates(s.history[0], s.current())
+	case "undo", "u":
+		if len(s.history) == 1 {
+			fmt.Fprintln(s.out, "Nothing to undo")
+			break
+		}
+		s.history = s.history[:len(s.history)-1]
+		s.printStatus()
+	case "hint", "h":
+		if s.current().terminal() {
+			fmt.Fprintln(s.out, "The fight is over")
+			break
+		}
+		spell, cost, ok := s.current().hint()
+		switch {
+		case !ok:
+			fmt.Fprintln(s.out, "Hint: there is no way to win from here")
+		case spell == "":
+			fmt.Fprintf(s.out, "Hint: the active effects finish the boss, cast anything (total %d mana)\n", cost+s.current().cost)
+		default:
+			fmt.Fprintf(s.out, "Hint: cast %s (cheapest win costs %d more mana, %d total)\n", spell, cost, cost+s.current().cost)
+		}
+	default:
+		if s.current().terminal() {
+			fmt.Fprintln(s.out, "The fight is over, type 'undo' or 'quit'")
+			break
+		}
+		spell, ok := findSpell(cmd)
+		if !ok {
+			fmt.Fprintf(s.out, "Unknown command %q, type 'help' for a list\n", cmd)
+			break
+		}
+		next, err := s.current().playRound(spell)
+		if err != nil {
+			fmt.Fprintf(s.out, "Can't do that: %v\n", err)
+			break
+		}
+		s.printStates(s.current(), next)
+		s.history = append(s.history, next)
+		s.printStatus()
+	}
+	return true
+}
+
+func (s *Session) Run() {
+	s.printHelp()
+	s.printStatus()
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return
+		}
+		cmd := strings.ToLower(strings.TrimSpace(s.in.Text()))
+		if !s.handle(cmd) {
+			return
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gorel/advent-2015/pkg/combat"
+)
+
+// Event is one step of a fight in the JSON Lines replay log. The first
+// event of a log is always the "start" event, which also records the
+// modifiers the fight was played with.
+type Event struct {
+	Turn   int    `json:"turn"`
+	Step   int    `json:"step"`
+	Phase  string `json:"phase"`
+	Action string `json:"action"`
+	Spell  string `json:"spell,omitempty"`
+
+	// What changed during this step
+	BossDamage   int `json:"bossDamage"`
+	PlayerDamage int `json:"playerDamage"`
+	Healing      int `json:"healing"`
+	Mana         int `json:"mana"`
+
+	// Where things stand after this step
+	Player    EntitySnapshot   `json:"player"`
+	Boss      EntitySnapshot   `json:"boss"`
+	Effects   []EffectSnapshot `json:"effects"`
+	Modifiers []ModifierSpec   `json:"modifiers,omitempty"`
+}
+
+type EntitySnapshot struct {
+	HP     int `json:"hp"`
+	Mana   int `json:"mana"`
+	Damage int `json:"damage"`
+	Armor  int `json:"armor"`
+}
+
+type EffectSnapshot struct {
+	Name  string `json:"name"`
+	Turns int    `json:"turns"`
+}
+
+type ModifierSpec struct {
+	Name string `json:"name"`
+	Args []int  `json:"args,omitempty"`
+}
+
+func snapshot(e combat.Entity) EntitySnapshot {
+	return EntitySnapshot{
+		HP:     e.HP,
+		Mana:   e.Mana,
+		Damage: e.Damage,
+		Armor:  e.TotalArmor(),
+	}
+}
+
+func (g *GameState) actionType() string {
+	if g.turn == 0 {
+		return "start"
+	}
+	switch g.turn % 4 {
+	case 1, 3:
+		return "effects"
+	case 2:
+		return "cast"
+	default:
+		return "attack"
+	}
+}
+
+func (g *GameState) event() Event {
+	e := Event{
+		Turn:    g.round(),
+		Step:    g.turn,
+		Phase:   g.turnString(),
+		Action:  g.actionType(),
+		Spell:   g.spell,
+		Player:  snapshot(g.Player),
+		Boss:    snapshot(g.Boss),
+		Effects: []EffectSnapshot{},
+	}
+	if g.turn == 0 {
+		e.Turn = 0
+		for _, m := range g.modifiers {
+			e.Modifiers = append(e.Modifiers, ModifierSpec{m.name, m.args})
+		}
+	}
+	if g.prev != nil {
+		e.BossDamage = g.prev.Boss.HP - g.Boss.HP
+		e.PlayerDamage = max(0, g.prev.Player.HP-g.Player.HP)
+		e.Healing = max(0, g.Player.HP-g.prev.Player.HP)
+		e.Mana = g.Player.Mana - g.prev.Player.Mana
+	}
+	for _, effect := range g.Effects {
+		e.Effects = append(e.Effects, EffectSnapshot{effect.Name, effect.Turns})
+	}
+	sort.Slice(e.Effects, func(i, j int) bool {
+		return e.Effects[i].Name < e.Effects[j].Name
+	})
+	return e
+}
+
+// WriteLog writes the fight starting at g as JSON Lines, one event per step.
+func (g *GameState) WriteLog(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for cur := g; cur != nil; cur = cur.next {
+		if err := enc.Encode(cur.event()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	dec := json.NewDecoder(r)
+	for {
+		var e Event
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+}
+
+func checkEvent(want Event, got *GameState) error {
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got.event())
+	if !bytes.Equal(wantJSON, gotJSON) {
+		return fmt.Errorf("turn %d (%s): log has\n  %s\nbut replay gives\n  %s", want.Turn, want.Phase, wantJSON, gotJSON)
+	}
+	return nil
+}
+
+// Replay re-simulates a fight from its replay log and checks that every
+// step matches what the current rules produce. It returns the final state
+// of the fight.
+func Replay(r io.Reader) (*GameState, error) {
+	events, err := readEvents(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || events[0].Action != "start" {
+		return nil, errors.New("log has to begin with a start event")
+	}
+
+	start := events[0]
+	opts := []gameOption{}
+	for _, spec := range start.Modifiers {
+		m, err := modifierFromSpec(spec.Name, spec.Args)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, withModifiers(m))
+	}
+	for _, e := range start.Effects {
+		effect, ok := findEffect(e.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown effect %q", e.Name)
+		}
+		effect.Turns = e.Turns
+		opts = append(opts, withEffect(effect))
+	}
+	player := combat.Entity{Name: "Player", HP: start.Player.HP, Mana: start.Player.Mana, Damage: start.Player.Damage, Armor: start.Player.Armor}
+	boss := combat.Entity{Name: "Boss", HP: start.Boss.HP, Mana: start.Boss.Mana, Damage: start.Boss.Damage, Armor: start.Boss.Armor}
+	game := NewGame(player, boss, opts...)
+	if err := checkEvent(start, game); err != nil {
+		return nil, err
+	}
+
+	cur := game
+	for i := 1; i < len(events); {
+		if cur.terminal() {
+			return nil, fmt.Errorf("turn %d: log continues after the fight is over", events[i].Turn)
+		}
+
+		// Gather this round's events
+		turn := events[i].Turn
+		j := i
+		spell := spells[0]
+		for ; j < len(events) && events[j].Turn == turn; j++ {
+			if events[j].Action != "cast" {
+				continue
+			}
+			var ok bool
+			if spell, ok = findSpell(events[j].Spell); !ok {
+				return nil, fmt.Errorf("turn %d: unknown spell %q", turn, events[j].Spell)
+			}
+		}
+
+		next, err := cur.playRound(spell)
+		if err != nil {
+			return nil, fmt.Errorf("turn %d: %w", turn, err)
+		}
+		var round []*GameState
+		for s := next; s != cur; s = s.prev {
+			round = append(round, s)
+		}
+		if len(round) != j-i {
+			return nil, fmt.Errorf("turn %d: log has %d steps but replay takes %d", turn, j-i, len(round))
+		}
+		for k := range round {
+			if err := checkEvent(events[i+k], round[len(round)-1-k]); err != nil {
+				return nil, err
+			}
+		}
+		prev := cur
+		for k := len(round) - 1; k >= 0; k-- {
+			prev.next = round[k]
+			prev = round[k]
+		}
+		cur = next
+		i = j
+	}
+	return cur, nil
+}
+
+func findEffect(name string) (combat.Effect, bool) {
+	for _, spell := range spells {
+		if spell.Effect != nil && spell.Effect.Name == name {
+			return *spell.Effect, true
+		}
+	}
+	return combat.Effect{}, false
+}
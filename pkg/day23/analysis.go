@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnreachable   = errors.New("unreachable")
+	ErrComputedJump  = errors.New("jump offset read from a register")
+	ErrSelfModifying = errors.New("program rewrites itself with tgl")
+)
+
+// Issue is something the analysis found at instruction PC.
+type Issue struct {
+	PC  int
+	Err error
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("pc %d: %v", i.PC, i.Err)
+}
+
+type EdgeKind string
+
+const (
+	FALLTHROUGH EdgeKind = "fallthrough"
+	TAKEN       EdgeKind = "taken"
+	JUMP        EdgeKind = "jump"
+)
+
+// EXIT is the block index edges use when they leave the program.
+const EXIT = -1
+
+type Edge struct {
+	To   int
+	Kind EdgeKind
+}
+
+// Block is a basic block: instructions Start up to but not including End,
+// only entered at Start and only left from its last instruction.
+type Block struct {
+	Start, End int
+	Succs      []Edge
+	// Reads and Writes are every register the block's instructions read or
+	// write, sorted
+	Reads, Writes []string
+	Reachable     bool
+	// Computed is set when the block ends in a jump whose target isn't
+	// known until the program runs
+	Computed bool
+}
+
+// Analysis is the control flow graph of a program along with anything odd
+// found while building it.
+type Analysis struct {
+	Program *Program
+	Blocks  []Block
+	Issues  []Issue
+	// blockAt maps each instruction to the block it's in
+	blockAt []int
+}
+
+// Analyze builds the control flow graph of p without running it. A computed
+// jump could land anywhere, so once one is reachable every block counts as
+// reachable. Programs that use tgl can rewrite their own jumps, so for them
+// the graph is only a picture of the program as written.
+func Analyze(p *Program) *Analysis {
+	a := &Analysis{Program: p}
+	n := len(p.Instructions)
+
+	leaders := make([]bool, n+1)
+	leaders[0] = true
+	for i := range p.Instructions {
+		if !p.IsJump(i) {
+			continue
+		}
+		leaders[i+1] = true
+		if target, ok := p.JumpTarget(i); ok && target >= 0 && target < n {
+			leaders[target] = true
+		}
+	}
+
+	a.blockAt = make([]int, n)
+	for i := 0; i < n; i++ {
+		if leaders[i] {
+			a.Blocks = append(a.Blocks, Block{Start: i})
+		}
+		b := &a.Blocks[len(a.Blocks)-1]
+		b.End = i + 1
+		a.blockAt[i] = len(a.Blocks) - 1
+	}
+
+	selfModifying := false
+	for k := range a.Blocks {
+		b := &a.Blocks[k]
+		reads, writes := make(map[string]bool), make(map[string]bool)
+		for i := b.Start; i < b.End; i++ {
+			inst := p.Instructions[i]
+			def, _ := p.ISA.Lookup(inst.Op)
+			for _, arg := range def.Reads {
+				if inst.Args[arg].IsRegister() {
+					reads[inst.Args[arg].Reg] = true
+				}
+			}
+			for _, arg := range def.Writes {
+				if inst.Args[arg].IsRegister() {
+					writes[inst.Args[arg].Reg] = true
+				}
+			}
+			if inst.Op == TGL && !selfModifying {
+				selfModifying = true
+				a.Issues = append(a.Issues, Issue{i, ErrSelfModifying})
+			}
+		}
+		b.Reads, b.Writes = sortedKeys(reads), sortedKeys(writes)
+		a.addEdges(b)
+	}
+
+	a.markReachable()
+	for _, b := range a.Blocks {
+		if !b.Reachable {
+			a.Issues = append(a.Issues, Issue{b.Start, fmt.Errorf("%w: %d instructions", ErrUnreachable, b.End-b.Start)})
+		}
+	}
+	sort.SliceStable(a.Issues, func(i, j int) bool { return a.Issues[i].PC < a.Issues[j].PC })
+	return a
+}
+
+// addEdges works out where control goes after b's last instruction.
+func (a *Analysis) addEdges(b *Block) {
+	p := a.Program
+	last := b.End - 1
+	if !p.IsJump(last) {
+		b.Succs = append(b.Succs, Edge{a.block(b.End), FALLTHROUGH})
+		return
+	}
+	def, _ := p.ISA.Lookup(p.Instructions[last].Op)
+	kind := JUMP
+	if def.Conditional {
+		kind = TAKEN
+		b.Succs = append(b.Succs, Edge{a.block(b.End), FALLTHROUGH})
+	}
+	target, ok := p.JumpTarget(last)
+	if !ok {
+		b.Computed = true
+		a.Issues = append(a.Issues, Issue{last, ErrComputedJump})
+		return
+	}
+	if !p.validTarget(target) {
+		a.Issues = append(a.Issues, Issue{last, fmt.Errorf("%w: %d", ErrJumpTarget, target)})
+	}
+	b.Succs = append(b.Succs, Edge{a.block(target), kind})
+}
+
+// block is the index of the block starting at pc, or EXIT if pc is outside
+// the program.
+func (a *Analysis) block(pc int) int {
+	if pc < 0 || pc >= len(a.blockAt) {
+		return EXIT
+	}
+	return a.blockAt[pc]
+}
+
+func (a *Analysis) markReachable() {
+	if len(a.Blocks) == 0 {
+		return
+	}
+	queue := []int{0}
+	a.Blocks[0].Reachable = true
+	for len(queue) > 0 {
+		b := &a.Blocks[queue[0]]
+		queue = queue[1:]
+		if b.Computed {
+			for k := range a.Blocks {
+				a.Blocks[k].Reachable = true
+			}
+			return
+		}
+		for _, e := range b.Succs {
+			if e.To != EXIT && !a.Blocks[e.To].Reachable {
+				a.Blocks[e.To].Reachable = true
+				queue = append(queue, e.To)
+			}
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func blockName(k int) string {
+	if k == EXIT {
+		return "exit"
+	}
+	return fmt.Sprintf("B%d", k)
+}
+
+func registerList(regs []string) string {
+	if len(regs) == 0 {
+		return "-"
+	}
+	return strings.Join(regs, " ")
+}
+
+// WriteReport prints each block with its registers and successors, then the
+// issues found.
+func (a *Analysis) WriteReport(w io.Writer) {
+	for k, b := range a.Blocks {
+		var succs []string
+		for _, e := range b.Succs {
+			succs = append(succs, fmt.Sprintf("%s (%s)", blockName(e.To), e.Kind))
+		}
+		if b.Computed {
+			succs = append(succs, "? (computed)")
+		}
+		fmt.Fprintf(w, "%s: pc %d-%d  reads %s  writes %s  -> %s\n",
+			blockName(k), b.Start, b.End-1, registerList(b.Reads), registerList(b.Writes), strings.Join(succs, ", "))
+	}
+	if len(a.Issues) == 0 {
+		fmt.Fprintln(w, "No issues found")
+		return
+	}
+	fmt.Fprintln(w, "Issues:")
+	for _, issue := range a.Issues {
+		fmt.Fprintf(w, "  %s\n", issue)
+	}
+}
+
+// WriteDOT writes the control flow graph in Graphviz format. Unreachable
+// blocks are drawn dashed.
+func (a *Analysis) WriteDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph cfg {")
+	fmt.Fprintln(w, `  node [shape=box, fontname="monospace"];`)
+	fmt.Fprintln(w, `  entry [shape=point];`)
+	fmt.Fprintln(w, `  exit [shape=doublecircle, label="exit"];`)
+	for k, b := range a.Blocks {
+		var label strings.Builder
+		fmt.Fprintf(&label, "%s\\l", blockName(k))
+		for i := b.Start; i < b.End; i++ {
+			fmt.Fprintf(&label, "%d: %s\\l", i, a.Program.Instructions[i])
+		}
+		fmt.Fprintf(&label, "reads: %s\\lwrites: %s\\l", registerList(b.Reads), registerList(b.Writes))
+		style := ""
+		if !b.Reachable {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "  %s [label=\"%s\"%s];\n", blockName(k), label.String(), style)
+	}
+	if len(a.Blocks) > 0 {
+		fmt.Fprintf(w, "  entry -> %s;\n", blockName(0))
+	} else {
+		fmt.Fprintln(w, "  entry -> exit;")
+	}
+	for k, b := range a.Blocks {
+		for _, e := range b.Succs {
+			fmt.Fprintf(w, "  %s -> %s [label=%q];\n", blockName(k), blockName(e.To), e.Kind)
+		}
+		if b.Computed {
+			fmt.Fprintf(w, "  %s -> computed%d [style=dotted];\n", blockName(k), k)
+			fmt.Fprintf(w, "  computed%d [shape=plaintext, label=\"?\"];\n", k)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instruction is one assembled line of a program.
+type Instruction struct {
+	Op   Opcode
+	Args []Operand
+}
+
+// String formats the instruction the way it's written in the puzzle input.
+func (i Instruction) String() string {
+	var args []string
+	for _, arg := range i.Args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("%s %s", i.Op, strings.Join(args, ", "))
+}
+
+func (i Instruction) Equal(other Instruction) bool {
+	if i.Op != other.Op || len(i.Args) != len(other.Args) {
+		return false
+	}
+	for k := range i.Args {
+		if i.Args[k] != other.Args[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Program is an assembled program along with the instruction set and
+// register file it was written for.
+type Program struct {
+	ISA          *ISA
+	Registers    []string
+	Instructions []Instruction
+	// Lines maps each instruction to its 1-indexed line in the source
+	Lines []int
+}
+
+func (p *Program) HasRegister(name string) bool {
+	for _, r := range p.Registers {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Program) IsJump(i int) bool {
+	def, _ := p.ISA.Lookup(p.Instructions[i].Op)
+	return def.JumpArg >= 0
+}
+
+// JumpTarget is the absolute target of the jump at i. It returns false if
+// the instruction isn't a jump or jumps by a register's value.
+func (p *Program) JumpTarget(i int) (int, bool) {
+	inst := p.Instructions[i]
+	def, _ := p.ISA.Lookup(inst.Op)
+	if def.JumpArg < 0 || inst.Args[def.JumpArg].IsRegister() {
+		return 0, false
+	}
+	return i + inst.Args[def.JumpArg].Imm, true
+}
+
+var (
+	ErrUnknownOpcode = errors.New("unknown opcode")
+	ErrArity         = errors.New("wrong number of operands")
+	ErrRegister      = errors.New("invalid register")
+	ErrOffset        = errors.New("invalid jump offset")
+	ErrValue         = errors.New("invalid value")
+	ErrJumpTarget    = errors.New("jump target outside the program")
+	ErrDirective     = errors.New("invalid directive")
+)
+
+// AsmError is a problem with one line of a program. Line is 1-indexed.
+type AsmError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *AsmError) Error() string {
+	return fmt.Sprintf("line %d (%q): %v", e.Line, e.Text, e.Err)
+}
+
+func (e *AsmError) Unwrap() error {
+	return e.Err
+}
+
+func (p *Program) assembleLine(line string) (Instruction, error) {
+	fields := strings.Fields(strings.ReplaceAll(line, ",", " "))
+	inst := Instruction{Op: Opcode(fields[0])}
+	def, ok := p.ISA.Lookup(inst.Op)
+	if !ok {
+		return inst, fmt.Errorf("%w %q", ErrUnknownOpcode, fields[0])
+	}
+	args := fields[1:]
+	if len(args) != len(def.Operands) {
+		return inst, fmt.Errorf("%w: %s takes %d, got %d", ErrArity, inst.Op, len(def.Operands), len(args))
+	}
+	for i, kind := range def.Operands {
+		arg := Operand{Kind: kind}
+		n, err := strconv.Atoi(args[i])
+		switch {
+		case kind == OFFSET && err != nil:
+			return inst, fmt.Errorf("%w %q", ErrOffset, args[i])
+		case kind == VALUE && err != nil && !p.HasRegister(args[i]):
+			return inst, fmt.Errorf("%w %q, want a number or one of %s", ErrValue, args[i], strings.Join(p.Registers, ", "))
+		case kind == REGISTER && !p.HasRegister(args[i]):
+			return inst, fmt.Errorf("%w %q, want one of %s", ErrRegister, args[i], strings.Join(p.Registers, ", "))
+		case err == nil:
+			arg.Imm = n
+		default:
+			arg.Reg = args[i]
+		}
+		inst.Args = append(inst.Args, arg)
+	}
+	return inst, nil
+}
+
+// Assemble parses a program for the given instruction set and checks it,
+// returning every problem found. Blank lines are skipped, and a
+//
+//	.registers a b c
+//
+// line before the first instruction replaces the ISA's default registers.
+// Jumping to one past the last instruction is allowed since that's how a
+// program halts.
+func Assemble(isa *ISA, lines []string) (*Program, error) {
+	p, err := assemble(isa, lines)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for i := range p.Instructions {
+		if target, ok := p.JumpTarget(i); ok && !p.validTarget(target) {
+			line := p.Lines[i]
+			errs = append(errs, &AsmError{line, lines[line-1], fmt.Errorf("%w: %d", ErrJumpTarget, target)})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+func (p *Program) validTarget(target int) bool {
+	return target >= 0 && target <= len(p.Instructions)
+}
+
+// assemble is Assemble without the jump target checks, so analysis can
+// report them alongside everything else.
+func assemble(isa *ISA, lines []string) (*Program, error) {
+	p := &Program{ISA: isa, Registers: isa.Registers}
+	var errs []error
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == ".registers" {
+			if len(p.Instructions) > 0 || len(fields) == 1 {
+				errs = append(errs, &AsmError{i + 1, line, ErrDirective})
+				continue
+			}
+			p.Registers = fields[1:]
+			continue
+		}
+		inst, err := p.assembleLine(line)
+		if err != nil {
+			errs = append(errs, &AsmError{i + 1, line, err})
+		}
+		p.Instructions = append(p.Instructions, inst)
+		p.Lines = append(p.Lines, i+1)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+// Disassemble pretty-prints a program with each jump's absolute target.
+func Disassemble(p *Program) string {
+	var sb strings.Builder
+	width := len(strconv.Itoa(len(p.Instructions)))
+	for i, inst := range p.Instructions {
+		line := fmt.Sprintf("%*d  %-12s", width, i, inst)
+		if target, ok := p.JumpTarget(i); ok {
+			if target == len(p.Instructions) {
+				line += fmt.Sprintf("; -> %d (halt)", target)
+			} else {
+				line += fmt.Sprintf("; -> %d", target)
+			}
+		} else if p.IsJump(i) {
+			line += "; -> computed"
+		}
+		sb.WriteString(strings.TrimRight(line, " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
-	"strings"
 
 	"golang.org/x/exp/constraints"
 )
@@ -39,72 +41,151 @@ func max[T constraints.Ordered](args ...T) T {
 type Computer struct {
 	pc           int
 	registers    map[string]uint64
-	instructions [][]string
+	instructions []Instruction
+	isa          *ISA
+	output       []uint64
 }
 
-func NewComputer(lines []string) Computer {
-	var instructions [][]string
-	for _, line := range lines {
-		sanitized := strings.ReplaceAll(line, ",", "")
-		parts := strings.Split(sanitized, " ")
-		instructions = append(instructions, parts)
+func NewComputer(p *Program) Computer {
+	registers := make(map[string]uint64)
+	for _, name := range p.Registers {
+		registers[name] = 0
 	}
 	return Computer{
-		registers:    make(map[string]uint64),
-		instructions: instructions,
+		registers: registers,
+		// tgl rewrites instructions, so every computer gets its own copy
+		instructions: append([]Instruction(nil), p.Instructions...),
+		isa:          p.ISA,
 	}
 }
 
-func (c *Computer) Run() {
-	for c.pc >= 0 && c.pc < len(c.instructions) {
-		i := c.instructions[c.pc]
-		switch i[0] {
-		case "hlf":
-			c.registers[i[1]] /= 2
-			c.pc += 1
-
-		case "tpl":
-			c.registers[i[1]] *= 3
-			c.pc += 1
-
-		case "inc":
-			c.registers[i[1]] += 1
-			c.pc += 1
-
-		case "jmp":
-			c.pc += toInt(i[1])
-
-		case "jie":
-			inc := 1
-			if c.registers[i[1]]%2 == 0 {
-				inc = toInt(i[2])
-			}
-			c.pc += inc
-
-		case "jio":
-			inc := 1
-			if c.registers[i[1]] == 1 {
-				inc = toInt(i[2])
-			}
-			c.pc += inc
+func (c *Computer) Halted() bool {
+	return c.pc < 0 || c.pc >= len(c.instructions)
+}
+
+// Step runs the instruction at pc. It returns false without doing anything
+// if the computer has already halted.
+func (c *Computer) Step() bool {
+	if c.Halted() {
+		return false
+	}
+	i := c.instructions[c.pc]
+	def, ok := c.isa.Lookup(i.Op)
+	if !ok {
+		panic(fmt.Sprintf("Unknown opcode %q at %d", i.Op, c.pc))
+	}
+	def.Exec(c, i.Args)
+	return true
+}
+
+var ErrStepLimit = errors.New("step limit reached")
+
+// Run steps until the program halts, or returns ErrStepLimit once maxSteps
+// instructions have run (0 for no limit).
+func (c *Computer) Run(maxSteps int) error {
+	for steps := 0; !c.Halted(); steps++ {
+		if maxSteps > 0 && steps >= maxSteps {
+			return fmt.Errorf("%w after %d instructions at pc %d", ErrStepLimit, steps, c.pc)
 		}
+		c.Step()
 	}
+	return nil
 }
 
+var (
+	disasm   = flag.Bool("disasm", false, "print the disassembled program instead of running it")
+	analyze  = flag.Bool("analyze", false, "print the program's basic blocks and any problems instead of running it")
+	dot      = flag.Bool("dot", false, "print the program's control flow graph in DOT format instead of running it")
+	debug    = flag.Bool("debug", false, "step through the program in the debugger (needs -f)")
+	program  = flag.String("f", "", "read the program from this file instead of stdin")
+	isaName  = flag.String("isa", "day23", "instruction set the program is written for: day23 or assembunny")
+	maxSteps = flag.Int("max-steps", 100_000_000, "stop after this many instructions (0 for no limit)")
+)
+
 func main() {
-	scanner := bufio.NewScanner(os.Stdin)
+	flag.Parse()
+
+	input := os.Stdin
+	if *program != "" {
+		f, err := os.Open(*program)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		input = f
+	} else if *debug {
+		log.Fatal("-debug reads commands from stdin, pass the program with -f")
+	}
+	scanner := bufio.NewScanner(input)
 
 	var lines []string
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
 
-	c := NewComputer(lines)
-	c.Run()
-	fmt.Printf("Part 1: %d\n", c.registers["b"])
+	isa, ok := isas[*isaName]
+	if !ok {
+		log.Fatalf("unknown instruction set %q", *isaName)
+	}
+	if *analyze || *dot {
+		// Out of range jumps are reported by the analysis rather than
+		// refusing the program
+		prog, err := assemble(isa, lines)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a := Analyze(prog)
+		if *dot {
+			a.WriteDOT(os.Stdout)
+		} else {
+			a.WriteReport(os.Stdout)
+		}
+		return
+	}
+	prog, err := Assemble(isa, lines)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *disasm {
+		fmt.Print(Disassemble(prog))
+		return
+	}
+	if *debug {
+		c := NewComputer(prog)
+		NewDebugSession(NewDebugger(&c, *maxSteps), os.Stdin, os.Stdout).Run()
+		return
+	}
+	if isa != Day23ISA {
+		c := NewComputer(prog)
+		if err := c.Run(*maxSteps); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(formatRegisters(c.registers))
+		if len(c.output) > 0 {
+			fmt.Printf("output: %v\n", c.output)
+		}
+		return
+	}
+	c1, err := Compile(prog, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c1.Run(*maxSteps); err != nil {
+		log.Fatal(err)
+	}
+	b1, err := c1.Register("b")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Part 1: %d\n", b1)
 
-	c2 := NewComputer(lines)
-	c2.registers["a"] = 1
-	c2.Run()
-	fmt.Printf("Part 2: %d\n", c2.registers["b"])
+	c2, _ := Compile(prog, true)
+	if err := c2.SetRegister("a", 1); err != nil {
+		log.Fatal(err)
+	}
+	if err := c2.Run(*maxSteps); err != nil {
+		log.Fatal(err)
+	}
+	b2, _ := c2.Register("b")
+	fmt.Printf("Part 2: %d\n", b2)
 }
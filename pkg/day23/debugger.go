@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type StopReason string
+
+const (
+	STEPPED    StopReason = "stepped"
+	BREAKPOINT StopReason = "breakpoint"
+	WATCHPOINT StopReason = "watchpoint"
+	HALTED     StopReason = "halted"
+	STEP_LIMIT StopReason = "step limit"
+)
+
+// Stop says why the debugger handed control back.
+type Stop struct {
+	Reason StopReason
+	PC     int
+	Detail string
+}
+
+func (s Stop) String() string {
+	if s.Detail == "" {
+		return fmt.Sprintf("%s at pc %d", s.Reason, s.PC)
+	}
+	return fmt.Sprintf("%s at pc %d: %s", s.Reason, s.PC, s.Detail)
+}
+
+// Condition compares a register against a constant, like "a == 1".
+type Condition struct {
+	Reg   string
+	Op    string
+	Value uint64
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s %d", c.Reg, c.Op, c.Value)
+}
+
+var comparisons = map[string]func(a, b uint64) bool{
+	"==": func(a, b uint64) bool { return a == b },
+	"!=": func(a, b uint64) bool { return a != b },
+	"<":  func(a, b uint64) bool { return a < b },
+	"<=": func(a, b uint64) bool { return a <= b },
+	">":  func(a, b uint64) bool { return a > b },
+	">=": func(a, b uint64) bool { return a >= b },
+}
+
+func (c *Computer) hasRegister(name string) bool {
+	_, ok := c.registers[name]
+	return ok
+}
+
+func parseCondition(c *Computer, fields []string) (Condition, error) {
+	if len(fields) != 3 {
+		return Condition{}, errors.New("want a condition like: a == 1")
+	}
+	if !c.hasRegister(fields[0]) {
+		return Condition{}, fmt.Errorf("%w %q", ErrRegister, fields[0])
+	}
+	if _, ok := comparisons[fields[1]]; !ok {
+		return Condition{}, fmt.Errorf("unknown comparison %q", fields[1])
+	}
+	value, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return Condition{}, err
+	}
+	return Condition{fields[0], fields[1], value}, nil
+}
+
+func (c Condition) holds(registers map[string]uint64) bool {
+	return comparisons[c.Op](registers[c.Reg], c.Value)
+}
+
+// Breakpoint stops execution before the instruction at PC runs. PC -1
+// matches every instruction, which only makes sense with a condition.
+type Breakpoint struct {
+	PC   int
+	Cond *Condition
+}
+
+func (b Breakpoint) String() string {
+	where := fmt.Sprintf("pc %d", b.PC)
+	if b.PC < 0 {
+		where = "any pc"
+	}
+	if b.Cond == nil {
+		return where
+	}
+	return fmt.Sprintf("%s if %s", where, b.Cond)
+}
+
+// TraceEntry is one executed instruction. Registers are their values
+// after it ran.
+type TraceEntry struct {
+	Step      int
+	PC        int
+	Inst      Instruction
+	Registers map[string]uint64
+}
+
+func formatRegisters(registers map[string]uint64) string {
+	var names []string
+	for name := range registers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, registers[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (t TraceEntry) String() string {
+	return fmt.Sprintf("#%d  %3d  %-12s %s", t.Step, t.PC, t.Inst, formatRegisters(t.Registers))
+}
+
+// Debugger drives a Computer one instruction at a time.
+type Debugger struct {
+	c           *Computer
+	breakpoints []Breakpoint
+	watches     map[string]bool
+	steps       int
+	maxSteps    int
+
+	tracing    bool
+	traceLimit int
+	trace      []TraceEntry
+}
+
+// NewDebugger wraps c. Execution stops with STEP_LIMIT once maxSteps
+// instructions have run in total, so runaway loops get reported instead of
+// hanging; 0 means no limit.
+func NewDebugger(c *Computer, maxSteps int) *Debugger {
+	return &Debugger{
+		c:          c,
+		watches:    make(map[string]bool),
+		maxSteps:   maxSteps,
+		traceLimit: 1000,
+	}
+}
+
+func (d *Debugger) Steps() int {
+	return d.steps
+}
+
+func (d *Debugger) Break(b Breakpoint) {
+	d.breakpoints = append(d.breakpoints, b)
+}
+
+// Delete removes breakpoint number n as listed by Breakpoints.
+func (d *Debugger) Delete(n int) error {
+	if n < 0 || n >= len(d.breakpoints) {
+		return fmt.Errorf("no breakpoint %d", n)
+	}
+	d.breakpoints = append(d.breakpoints[:n], d.breakpoints[n+1:]...)
+	return nil
+}
+
+func (d *Debugger) Breakpoints() []Breakpoint {
+	return d.breakpoints
+}
+
+// Watch stops execution whenever reg changes.
+func (d *Debugger) Watch(reg string) error {
+	if !d.c.hasRegister(reg) {
+		return fmt.Errorf("%w %q", ErrRegister, reg)
+	}
+	d.watches[reg] = true
+	return nil
+}
+
+func (d *Debugger) Unwatch(reg string) {
+	delete(d.watches, reg)
+}
+
+// SetTrace turns recording on or off. Only the last limit entries are kept.
+func (d *Debugger) SetTrace(on bool, limit int) {
+	d.tracing = on
+	d.traceLimit = limit
+}
+
+func (d *Debugger) Trace() []TraceEntry {
+	return d.trace
+}
+
+func (d *Debugger) record(pc int, inst Instruction) {
+	registers := make(map[string]uint64, len(d.c.registers))
+	for k, v := range d.c.registers {
+		registers[k] = v
+	}
+	d.trace = append(d.trace, TraceEntry{d.steps, pc, inst, registers})
+	if over := len(d.trace) - d.traceLimit; over > 0 {
+		d.trace = append(d.trace[:0], d.trace[over:]...)
+	}
+}
+
+// step runs one instruction and reports a watchpoint if it changed a
+// watched register.
+func (d *Debugger) step() (Stop, bool) {
+	if d.c.Halted() {
+		return Stop{Reason: HALTED, PC: d.c.pc}, true
+	}
+	if d.maxSteps > 0 && d.steps >= d.maxSteps {
+		return Stop{Reason: STEP_LIMIT, PC: d.c.pc, Detail: fmt.Sprintf("%d instructions run", d.steps)}, true
+	}
+
+	pc := d.c.pc
+	inst := d.c.instructions[pc]
+	before := make(map[string]uint64, len(d.watches))
+	for reg := range d.watches {
+		before[reg] = d.c.registers[reg]
+	}
+	d.c.Step()
+	d.steps++
+	if d.tracing {
+		d.record(pc, inst)
+	}
+
+	var changed []string
+	for reg, old := range before {
+		if d.c.registers[reg] != old {
+			changed = append(changed, fmt.Sprintf("%s: %d -> %d", reg, old, d.c.registers[reg]))
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		detail := fmt.Sprintf("%s changed %s", inst, strings.Join(changed, ", "))
+		return Stop{Reason: WATCHPOINT, PC: d.c.pc, Detail: detail}, true
+	}
+	return Stop{Reason: STEPPED, PC: d.c.pc}, false
+}
+
+func (d *Debugger) hitBreakpoint() (Breakpoint, bool) {
+	for _, b := range d.breakpoints {
+		if b.PC >= 0 && b.PC != d.c.pc {
+			continue
+		}
+		if b.Cond == nil || b.Cond.holds(d.c.registers) {
+			return b, true
+		}
+	}
+	return Breakpoint{}, false
+}
+
+// Step runs a single instruction.
+func (d *Debugger) Step() Stop {
+	stop, _ := d.step()
+	if stop.Reason == STEPPED && d.c.Halted() {
+		stop.Reason = HALTED
+	}
+	return stop
+}
+
+// Continue runs until a breakpoint, watchpoint, the step limit, or the
+// program halts. It always runs at least one instruction, so continuing
+// from a breakpoint doesn't stop on it again straight away.
+func (d *Debugger) Continue() Stop {
+	for {
+		if stop, done := d.step(); done {
+			return stop
+		}
+		if b, ok := d.hitBreakpoint(); ok {
+			return Stop{Reason: BREAKPOINT, PC: d.c.pc, Detail: b.String()}
+		}
+	}
+}
+
+// DebugSession is the command line front end for a Debugger.
+type DebugSession struct {
+	d   *Debugger
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func NewDebugSession(d *Debugger, in io.Reader, out io.Writer) *DebugSession {
+	return &DebugSession{d, bufio.NewScanner(in), out}
+}
+
+func (s *DebugSession) printHelp() {
+	fmt.Fprintln(s.out, `Commands:
+  step [n]             run n instructions (default 1)
+  continue             run until something stops execution
+  break <pc> [if <reg> <op> <value>]
+  break if <reg> <op> <value>
+                       stop before an instruction runs
+  delete <n>           remove breakpoint n
+  watch <reg>          stop when a register changes
+  unwatch <reg>
+  info                 list breakpoints and watchpoints
+  regs                 show the registers
+  set <reg> <value>    change a register
+  list                 disassemble around the current pc
+  trace on|off         record executed instructions
+  trace [n]            show the last n recorded instructions (default 20)
+  quit`)
+}
+
+func (s *DebugSession) printLocation() {
+	c := s.d.c
+	if c.Halted() {
+		fmt.Fprintf(s.out, "halted at pc %d after %d steps, %s\n", c.pc, s.d.Steps(), formatRegisters(c.registers))
+		return
+	}
+	fmt.Fprintf(s.out, "pc %d: %s  [%s, step %d]\n", c.pc, c.instructions[c.pc], formatRegisters(c.registers), s.d.Steps())
+}
+
+func (s *DebugSession) list() {
+	c := s.d.c
+	p := &Program{ISA: c.isa, Instructions: c.instructions}
+	lines := strings.Split(strings.TrimRight(Disassemble(p), "\n"), "\n")
+	for i := max(0, c.pc-5); i < min(len(lines), c.pc+6); i++ {
+		marker := "  "
+		if i == c.pc {
+			marker = "=>"
+		}
+		fmt.Fprintf(s.out, "%s %s\n", marker, lines[i])
+	}
+}
+
+func (s *DebugSession) handle(fields []string) error {
+	switch fields[0] {
+	case "step", "s":
+		n := 1
+		if len(fields) > 1 {
+			var err error
+			if n, err = strconv.Atoi(fields[1]); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < n; i++ {
+			stop := s.d.Step()
+			if stop.Reason != STEPPED {
+				fmt.Fprintln(s.out, stop)
+				break
+			}
+		}
+		s.printLocation()
+
+	case "continue", "c":
+		fmt.Fprintln(s.out, s.d.Continue())
+		s.printLocation()
+
+	case "break", "b":
+		if len(fields) < 2 {
+			return errors.New("usage: break <pc> [if <cond>] or break if <cond>")
+		}
+		b := Breakpoint{PC: -1}
+		rest := fields[1:]
+		if rest[0] != "if" {
+			pc, err := strconv.Atoi(rest[0])
+			if err != nil {
+				return err
+			}
+			if pc < 0 || pc >= len(s.d.c.instructions) {
+				return fmt.Errorf("pc %d is outside the program", pc)
+			}
+			b.PC = pc
+			rest = rest[1:]
+		}
+		if len(rest) > 0 {
+			if rest[0] != "if" {
+				return fmt.Errorf("unexpected %q", rest[0])
+			}
+			cond, err := parseCondition(s.d.c, rest[1:])
+			if err != nil {
+				return err
+			}
+			b.Cond = &cond
+		}
+		if b.PC < 0 && b.Cond == nil {
+			return errors.New("a breakpoint needs a pc, a condition, or both")
+		}
+		s.d.Break(b)
+		fmt.Fprintf(s.out, "breakpoint %d: %s\n", len(s.d.Breakpoints())-1, b)
+
+	case "delete", "d":
+		if len(fields) != 2 {
+			return errors.New("usage: delete <n>")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return err
+		}
+		return s.d.Delete(n)
+
+	case "watch", "w":
+		if len(fields) != 2 {
+			return errors.New("usage: watch <reg>")
+		}
+		return s.d.Watch(fields[1])
+
+	case "unwatch":
+		if len(fields) != 2 {
+			return errors.New("usage: unwatch <reg>")
+		}
+		s.d.Unwatch(fields[1])
+
+	case "info", "i":
+		for n, b := range s.d.Breakpoints() {
+			fmt.Fprintf(s.out, "breakpoint %d: %s\n", n, b)
+		}
+		var watched []string
+		for reg := range s.d.watches {
+			watched = append(watched, reg)
+		}
+		sort.Strings(watched)
+		for _, reg := range watched {
+			fmt.Fprintf(s.out, "watching %s\n", reg)
+		}
+
+	case "regs", "r":
+		fmt.Fprintln(s.out, formatRegisters(s.d.c.registers))
+
+	case "set":
+		if len(fields) != 3 {
+			return errors.New("usage: set <reg> <value>")
+		}
+		if !s.d.c.hasRegister(fields[1]) {
+			return fmt.Errorf("%w %q", ErrRegister, fields[1])
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		s.d.c.registers[fields[1]] = value
+
+	case "list", "l":
+		s.list()
+
+	case "trace", "t":
+		n := 20
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "on":
+				s.d.SetTrace(true, s.d.traceLimit)
+				return nil
+			case "off":
+				s.d.SetTrace(false, s.d.traceLimit)
+				return nil
+			}
+			var err error
+			if n, err = strconv.Atoi(fields[1]); err != nil {
+				return err
+			}
+			if n < 0 {
+				return errors.New("usage: trace [n|on|off] with n at least 0")
+			}
+		}
+		trace := s.d.Trace()
+		for _, t := range trace[min(len(trace), max(0, len(trace)-n)):] {
+			fmt.Fprintln(s.out, t)
+		}
+
+	case "help", "h", "?":
+		s.printHelp()
+
+	default:
+		return fmt.Errorf("unknown command %q, type 'help' for a list", fields[0])
+	}
+	return nil
+}
+
+func (s *DebugSession) Run() {
+	s.printLocation()
+	for {
+		fmt.Fprint(s.out, "(dbg) ")
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return
+		}
+		fields := strings.Fields(s.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "q" {
+			return
+		}
+		if err := s.handle(fields); err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
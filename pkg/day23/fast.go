@@ -0,0 +1,295 @@
+package main
+
+import "fmt"
+
+type fastOp uint8
+
+const (
+	opHLF fastOp = iota
+	opTPL
+	opINC
+	opJMP
+	opJIE
+	opJIO
+
+	// reg = reg*mul + add, standing in for span inc/tpl instructions
+	opAFFINE
+	// The Collatz step counter loop, see matchCollatz
+	opCOLLATZ
+)
+
+var fastOps = map[Opcode]fastOp{
+	HLF: opHLF,
+	TPL: opTPL,
+	INC: opINC,
+	JMP: opJMP,
+	JIE: opJIE,
+	JIO: opJIO,
+}
+
+// fastInst is a pre-decoded instruction with registers resolved to indexes.
+type fastInst struct {
+	op     fastOp
+	reg    int
+	reg2   int
+	offset int
+	mul    uint64
+	add    uint64
+	span   int
+}
+
+// FastComputer runs day 23 programs like Computer does, but from
+// pre-decoded instructions and an array of registers instead of an opcode
+// lookup and a map on every step.
+type FastComputer struct {
+	pc        int
+	names     []string
+	registers []uint64
+	program   []fastInst
+	// plain is the program without idioms, for when an idiom's bulk
+	// version can't be used
+	plain []fastInst
+}
+
+func registerIndex(names []string, name string) (int, error) {
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", ErrRegister, name)
+}
+
+// Compile decodes an assembled program. With optimize set it also replaces
+// common loop idioms with instructions that run them in bulk. Only the day
+// 23 instruction set can be compiled.
+func Compile(p *Program, optimize bool) (*FastComputer, error) {
+	if p.ISA != Day23ISA {
+		return nil, fmt.Errorf("can't compile %s programs", p.ISA.Name)
+	}
+	plain := make([]fastInst, len(p.Instructions))
+	for i, inst := range p.Instructions {
+		plain[i] = fastInst{op: fastOps[inst.Op]}
+		for _, arg := range inst.Args {
+			if arg.IsRegister() {
+				reg, err := registerIndex(p.Registers, arg.Reg)
+				if err != nil {
+					return nil, err
+				}
+				plain[i].reg = reg
+			} else {
+				plain[i].offset = arg.Imm
+			}
+		}
+	}
+
+	fast := append([]fastInst(nil), plain...)
+	if optimize {
+		entries := jumpEntries(p)
+		for i := range p.Instructions {
+			if inst, ok := matchCollatz(p, entries, i); ok {
+				fast[i] = inst
+			} else if inst, ok := matchAffine(p, entries, i); ok {
+				fast[i] = inst
+			}
+		}
+	}
+
+	return &FastComputer{
+		names:     p.Registers,
+		registers: make([]uint64, len(p.Registers)),
+		program:   fast,
+		plain:     plain,
+	}, nil
+}
+
+// jumpEntries maps every jump target to the instructions that jump there.
+func jumpEntries(p *Program) map[int][]int {
+	entries := make(map[int][]int)
+	for i := range p.Instructions {
+		if target, ok := p.JumpTarget(i); ok {
+			entries[target] = append(entries[target], i)
+		}
+	}
+	return entries
+}
+
+// enteredOnlyFrom reports whether the only jumps landing strictly inside
+// [start, end) come from instructions in that range too.
+func enteredOnlyFrom(entries map[int][]int, start, end int) bool {
+	for target := start + 1; target < end; target++ {
+		for _, from := range entries[target] {
+			if from < start || from >= end {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchAffine folds a run of inc/tpl on one register that nothing jumps
+// into the middle of.
+func matchAffine(p *Program, entries map[int][]int, i int) (fastInst, bool) {
+	program := p.Instructions
+	if program[i].Op != INC && program[i].Op != TPL {
+		return fastInst{}, false
+	}
+	reg := program[i].Args[0]
+	mul, add := uint64(1), uint64(0)
+	j := i
+	for ; j < len(program); j++ {
+		inst := program[j]
+		if (inst.Op != INC && inst.Op != TPL) || inst.Args[0] != reg || (j > i && len(entries[j]) > 0) {
+			break
+		}
+		if inst.Op == TPL {
+			mul, add = mul*3, add*3
+		} else {
+			add++
+		}
+	}
+	if j-i < 2 {
+		return fastInst{}, false
+	}
+	r, err := registerIndex(p.Registers, reg.Reg)
+	if err != nil {
+		return fastInst{}, false
+	}
+	return fastInst{op: opAFFINE, reg: r, mul: mul, add: add, span: j - i}, true
+}
+
+// matchCollatz spots the loop that counts Collatz steps of x into y:
+//
+//	jio x, +8
+//	inc y
+//	jie x, +4
+//	tpl x
+//	inc x
+//	jmp +2
+//	hlf x
+//	jmp -7
+func matchCollatz(p *Program, entries map[int][]int, i int) (fastInst, bool) {
+	program := p.Instructions
+	if i+8 > len(program) || program[i].Op != JIO || program[i+1].Op != INC {
+		return fastInst{}, false
+	}
+	x, y := program[i].Args[0], program[i+1].Args[0]
+	want := []Instruction{
+		{JIO, []Operand{x, offset(8)}},
+		{INC, []Operand{y}},
+		{JIE, []Operand{x, offset(4)}},
+		{TPL, []Operand{x}},
+		{INC, []Operand{x}},
+		{JMP, []Operand{offset(2)}},
+		{HLF, []Operand{x}},
+		{JMP, []Operand{offset(-7)}},
+	}
+	for k, inst := range want {
+		if !program[i+k].Equal(inst) {
+			return fastInst{}, false
+		}
+	}
+	if x == y || !enteredOnlyFrom(entries, i, i+8) {
+		return fastInst{}, false
+	}
+	rx, errx := registerIndex(p.Registers, x.Reg)
+	ry, erry := registerIndex(p.Registers, y.Reg)
+	if errx != nil || erry != nil {
+		return fastInst{}, false
+	}
+	return fastInst{op: opCOLLATZ, reg: rx, reg2: ry, span: 8}, true
+}
+
+func (c *FastComputer) Register(name string) (uint64, error) {
+	i, err := registerIndex(c.names, name)
+	if err != nil {
+		return 0, err
+	}
+	return c.registers[i], nil
+}
+
+func (c *FastComputer) SetRegister(name string, value uint64) error {
+	i, err := registerIndex(c.names, name)
+	if err != nil {
+		return err
+	}
+	c.registers[i] = value
+	return nil
+}
+
+// Run runs until the program halts, or returns ErrStepLimit once maxSteps
+// instructions have run (0 for no limit). An idiom counts as one
+// instruction however many it stands in for.
+func (c *FastComputer) Run(maxSteps int) error {
+	regs := c.registers
+	for steps := 0; c.pc >= 0 && c.pc < len(c.program); steps++ {
+		if maxSteps > 0 && steps >= maxSteps {
+			return fmt.Errorf("%w after %d instructions at pc %d", ErrStepLimit, steps, c.pc)
+		}
+		i := &c.program[c.pc]
+		switch i.op {
+		case opHLF:
+			regs[i.reg] /= 2
+			c.pc++
+		case opTPL:
+			regs[i.reg] *= 3
+			c.pc++
+		case opINC:
+			regs[i.reg]++
+			c.pc++
+		case opJMP:
+			c.pc += i.offset
+		case opJIE:
+			if regs[i.reg]%2 == 0 {
+				c.pc += i.offset
+			} else {
+				c.pc++
+			}
+		case opJIO:
+			if regs[i.reg] == 1 {
+				c.pc += i.offset
+			} else {
+				c.pc++
+			}
+
+		case opAFFINE:
+			regs[i.reg] = regs[i.reg]*i.mul + i.add
+			c.pc += i.span
+
+		case opCOLLATZ:
+			x := regs[i.reg]
+			if x == 0 {
+				// 0 never reaches 1, so run the real loop forever like Run would
+				i = &c.plain[c.pc]
+				if regs[i.reg] == 1 {
+					c.pc += i.offset
+				} else {
+					c.pc++
+				}
+				continue
+			}
+			n := uint64(0)
+			for x != 1 {
+				if x%2 == 0 {
+					x /= 2
+				} else {
+					x = 3*x + 1
+				}
+				n++
+			}
+			regs[i.reg] = x
+			regs[i.reg2] += n
+			c.pc += i.span
+		}
+	}
+	return nil
+}
+
+// Reset puts the computer back at the start of its program with every
+// register cleared.
+func (c *FastComputer) Reset() {
+	c.pc = 0
+	for i := range c.registers {
+		c.registers[i] = 0
+	}
+}
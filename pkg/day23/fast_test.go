@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+// collatz counts the Collatz steps from a down to 1 in b, which is the same
+// loop the puzzle inputs run.
+var collatz = []string{
+	"jio a, +8",
+	"inc b",
+	"jie a, +4",
+	"tpl a",
+	"inc a",
+	"jmp +2",
+	"hlf a",
+	"jmp -7",
+}
+
+// collatzStart takes 524 steps to reach 1.
+const collatzStart = 837799
+
+func assembleCollatz(b *testing.B) *Program {
+	p, err := Assemble(Day23ISA, collatz)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return p
+}
+
+func BenchmarkRun(b *testing.B) {
+	p := assembleCollatz(b)
+	for n := 0; n < b.N; n++ {
+		c := NewComputer(p)
+		c.registers["a"] = collatzStart
+		if err := c.Run(0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCompiled runs the pre-decoded interpreter with and without
+// idioms. Decoding happens once up front and isn't part of the timings.
+func BenchmarkCompiled(b *testing.B) {
+	p := assembleCollatz(b)
+	for _, optimize := range []bool{false, true} {
+		name := "decoded"
+		if optimize {
+			name = "idioms"
+		}
+		b.Run(name, func(b *testing.B) {
+			c, err := Compile(p, optimize)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for n := 0; n < b.N; n++ {
+				c.Reset()
+				if err := c.SetRegister("a", collatzStart); err != nil {
+					b.Fatal(err)
+				}
+				if err := c.Run(0); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if got, err := c.Register("b"); err != nil || got != 524 {
+				b.Fatalf("b = %d (%v), want 524", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import "fmt"
+
+type Opcode string
+
+const (
+	HLF Opcode = "hlf"
+	TPL Opcode = "tpl"
+	INC Opcode = "inc"
+	JMP Opcode = "jmp"
+	JIE Opcode = "jie"
+	JIO Opcode = "jio"
+
+	CPY Opcode = "cpy"
+	DEC Opcode = "dec"
+	JNZ Opcode = "jnz"
+	OUT Opcode = "out"
+	TGL Opcode = "tgl"
+	ADD Opcode = "add"
+	MUL Opcode = "mul"
+)
+
+type OperandKind int
+
+const (
+	// A register name
+	REGISTER OperandKind = iota
+	// A signed constant jump offset
+	OFFSET
+	// A register name or a constant
+	VALUE
+)
+
+// OpDef describes an opcode: what it takes and what it does.
+type OpDef struct {
+	Op       Opcode
+	Operands []OperandKind
+	// JumpArg is the index of the operand holding a relative jump, or -1
+	// if the opcode never jumps.
+	JumpArg int
+	// Conditional jumps can also fall through to the next instruction.
+	Conditional bool
+	// Reads and Writes are the indexes of the operands the opcode reads and
+	// writes when they're registers. Static analysis relies on them.
+	Reads  []int
+	Writes []int
+	// Toggle is what tgl turns this opcode into. It has to take the same
+	// number of operands.
+	Toggle Opcode
+	// Exec runs the instruction. It's responsible for moving pc, usually
+	// with c.next() or c.jump().
+	Exec func(c *Computer, args []Operand)
+}
+
+// ISA is an instruction set along with the registers programs get when
+// they don't declare their own.
+type ISA struct {
+	Name      string
+	Registers []string
+	ops       map[Opcode]OpDef
+}
+
+func NewISA(name string, registers ...string) *ISA {
+	return &ISA{
+		Name:      name,
+		Registers: registers,
+		ops:       make(map[Opcode]OpDef),
+	}
+}
+
+// Define adds an opcode to the instruction set.
+func (isa *ISA) Define(def OpDef) error {
+	if _, ok := isa.ops[def.Op]; ok {
+		return fmt.Errorf("%s: opcode %s is already defined", isa.Name, def.Op)
+	}
+	if def.JumpArg >= len(def.Operands) || (def.JumpArg >= 0 && def.Operands[def.JumpArg] == REGISTER) {
+		return fmt.Errorf("%s: opcode %s has an invalid jump operand", isa.Name, def.Op)
+	}
+	if def.Exec == nil {
+		return fmt.Errorf("%s: opcode %s has no semantics", isa.Name, def.Op)
+	}
+	isa.ops[def.Op] = def
+	return nil
+}
+
+func (isa *ISA) mustDefine(defs ...OpDef) *ISA {
+	for _, def := range defs {
+		if err := isa.Define(def); err != nil {
+			panic(err)
+		}
+	}
+	return isa
+}
+
+func (isa *ISA) Lookup(op Opcode) (OpDef, bool) {
+	def, ok := isa.ops[op]
+	return def, ok
+}
+
+// Operand is one argument of an instruction. Reg is empty for constants.
+type Operand struct {
+	Kind OperandKind
+	Reg  string
+	Imm  int
+}
+
+func (o Operand) IsRegister() bool {
+	return o.Reg != ""
+}
+
+func (o Operand) String() string {
+	switch {
+	case o.IsRegister():
+		return o.Reg
+	case o.Kind == OFFSET:
+		return fmt.Sprintf("%+d", o.Imm)
+	default:
+		return fmt.Sprintf("%d", o.Imm)
+	}
+}
+
+func reg(name string) Operand {
+	return Operand{Kind: REGISTER, Reg: name}
+}
+
+func offset(n int) Operand {
+	return Operand{Kind: OFFSET, Imm: n}
+}
+
+// Helpers for OpDef.Exec
+
+func (c *Computer) value(o Operand) uint64 {
+	if o.IsRegister() {
+		return c.registers[o.Reg]
+	}
+	return uint64(o.Imm)
+}
+
+// set writes a register. Writing to a constant, which tgl can produce, is
+// skipped.
+func (c *Computer) set(o Operand, v uint64) {
+	if o.IsRegister() {
+		c.registers[o.Reg] = v
+	}
+}
+
+func (c *Computer) next() {
+	c.pc++
+}
+
+func (c *Computer) jump(o Operand) {
+	c.pc += int(int64(c.value(o)))
+}
+
+// toggle rewrites the instruction at target as tgl does. Targets outside
+// the program, and opcodes without a toggle, are left alone.
+func (c *Computer) toggle(target int) {
+	if target < 0 || target >= len(c.instructions) {
+		return
+	}
+	inst := c.instructions[target]
+	def, _ := c.isa.Lookup(inst.Op)
+	toggled, ok := c.isa.Lookup(def.Toggle)
+	if !ok || len(toggled.Operands) != len(def.Operands) {
+		return
+	}
+	c.instructions[target] = Instruction{Op: toggled.Op, Args: inst.Args}
+}
+
+// unary builds a single operand opcode. REGISTER operands are updated in
+// place, anything else is only read.
+func unary(op Opcode, kind OperandKind, f func(c *Computer, a Operand)) OpDef {
+	def := OpDef{
+		Op:       op,
+		Operands: []OperandKind{kind},
+		JumpArg:  -1,
+		Reads:    []int{0},
+		Exec: func(c *Computer, args []Operand) {
+			f(c, args[0])
+		},
+	}
+	if kind == REGISTER {
+		def.Writes = []int{0}
+	}
+	return def
+}
+
+func binary(op Opcode, f func(x, y uint64) uint64) OpDef {
+	return OpDef{
+		Op:       op,
+		Operands: []OperandKind{VALUE, REGISTER},
+		JumpArg:  -1,
+		Reads:    []int{0, 1},
+		Writes:   []int{1},
+		Exec: func(c *Computer, args []Operand) {
+			c.set(args[1], f(c.value(args[0]), c.value(args[1])))
+			c.next()
+		},
+	}
+}
+
+// conditionalJump jumps by its offset when cond holds for the register.
+func conditionalJump(op Opcode, cond func(v uint64) bool) OpDef {
+	return OpDef{
+		Op:          op,
+		Operands:    []OperandKind{REGISTER, OFFSET},
+		JumpArg:     1,
+		Conditional: true,
+		Reads:       []int{0},
+		Exec: func(c *Computer, args []Operand) {
+			if cond(c.value(args[0])) {
+				c.jump(args[1])
+			} else {
+				c.next()
+			}
+		},
+	}
+}
+
+// Day23ISA is the 2015 day 23 computer.
+var Day23ISA = NewISA("day23", "a", "b").mustDefine(
+	unary(HLF, REGISTER, func(c *Computer, a Operand) {
+		c.set(a, c.value(a)/2)
+		c.next()
+	}),
+	unary(TPL, REGISTER, func(c *Computer, a Operand) {
+		c.set(a, c.value(a)*3)
+		c.next()
+	}),
+	unary(INC, REGISTER, func(c *Computer, a Operand) {
+		c.set(a, c.value(a)+1)
+		c.next()
+	}),
+	OpDef{
+		Op:       JMP,
+		Operands: []OperandKind{OFFSET},
+		JumpArg:  0,
+		Exec: func(c *Computer, args []Operand) {
+			c.jump(args[0])
+		},
+	},
+	conditionalJump(JIE, func(v uint64) bool { return v%2 == 0 }),
+	conditionalJump(JIO, func(v uint64) bool { return v == 1 }),
+)
+
+// AssembunnyISA is the language later puzzle years build on, with the
+// add and mul extensions.
+var AssembunnyISA = NewISA("assembunny", "a", "b", "c", "d").mustDefine(
+	OpDef{
+		Op:       CPY,
+		Operands: []OperandKind{VALUE, REGISTER},
+		JumpArg:  -1,
+		Toggle:   JNZ,
+		Reads:    []int{0},
+		Writes:   []int{1},
+		Exec: func(c *Computer, args []Operand) {
+			c.set(args[1], c.value(args[0]))
+			c.next()
+		},
+	},
+	withToggle(unary(INC, REGISTER, func(c *Computer, a Operand) {
+		c.set(a, c.value(a)+1)
+		c.next()
+	}), DEC),
+	withToggle(unary(DEC, REGISTER, func(c *Computer, a Operand) {
+		c.set(a, c.value(a)-1)
+		c.next()
+	}), INC),
+	OpDef{
+		Op:          JNZ,
+		Operands:    []OperandKind{VALUE, VALUE},
+		JumpArg:     1,
+		Conditional: true,
+		Toggle:      CPY,
+		Reads:       []int{0, 1},
+		Exec: func(c *Computer, args []Operand) {
+			if c.value(args[0]) != 0 {
+				c.jump(args[1])
+			} else {
+				c.next()
+			}
+		},
+	},
+	withToggle(unary(TGL, VALUE, func(c *Computer, a Operand) {
+		c.toggle(c.pc + int(int64(c.value(a))))
+		c.next()
+	}), INC),
+	withToggle(unary(OUT, VALUE, func(c *Computer, a Operand) {
+		c.output = append(c.output, c.value(a))
+		c.next()
+	}), INC),
+	withToggle(binary(ADD, func(x, y uint64) uint64 { return y + x }), JNZ),
+	withToggle(binary(MUL, func(x, y uint64) uint64 { return y * x }), JNZ),
+)
+
+func withToggle(def OpDef, toggle Opcode) OpDef {
+	def.Toggle = toggle
+	return def
+}
+
+var isas = map[string]*ISA{
+	Day23ISA.Name:      Day23ISA,
+	AssembunnyISA.Name: AssembunnyISA,
+}